@@ -2,7 +2,7 @@ package css
 
 /*
 DO NOT EDIT
-Autogenerated file by `build_assets.sh` at Thu Feb 28 23:01:41 EET 2019.
+Autogenerated file by `build_assets.sh` at Sun Oct 18 17:23:37 UTC 2026.
 */
 
 // CustomCSS - bundled asset, name should be self explanatory
@@ -34,4 +34,71 @@ em {
 .footer-links {
     margin-top: 10px;
 }
+.treemap {
+    position: relative;
+    width: 100%;
+    aspect-ratio: 16 / 10;
+    margin-bottom: 20px;
+    overflow: hidden;
+}
+
+.treemap .tile {
+    position: absolute;
+    overflow: hidden;
+    padding: 2px 4px;
+    border: 1px solid #fff;
+    background-color: #ccc;
+    color: #222;
+    font-size: 0.8rem;
+    text-decoration: none;
+    white-space: nowrap;
+}
+
+.treemap .tile.-dir {
+    background-color: #7da9d8;
+}
+
+.dark-grey .treemap .tile {
+    border-color: #181818;
+}
+
+.du-entry {
+    position: relative;
+    z-index: 0;
+}
+
+.du-bar {
+    position: absolute;
+    top: 0;
+    bottom: 0;
+    left: 0;
+    z-index: -1;
+    background-color: rgba(128, 128, 128, 0.2);
+}
+
+.du-bar.-dir {
+    background-color: rgba(125, 169, 216, 0.35);
+}
+
+.du-percent {
+    display: inline-block;
+    width: 4em;
+    text-align: right;
+}
+
+.readme .card-content {
+    padding: 1rem 2rem;
+}
+
+.readme img {
+    max-width: 100%;
+}
+
+.readme.-header {
+    margin-bottom: 20px;
+}
+
+.readme.-footer {
+    margin-top: 20px;
+}
 `
@@ -2,7 +2,7 @@ package templates
 
 /*
 DO NOT EDIT
-Autogenerated file by `build_assets.sh` at Thu Feb 28 23:01:41 EET 2019.
+Autogenerated file by `build_assets.sh` at Sun Oct 18 17:51:15 UTC 2026.
 */
 
 // HTML404 - bundled asset, name should be self explanatory
@@ -12,12 +12,12 @@ const HTML404 = `
         <div class="cell -12of12">
             <div class="card">
                 <header class="card-header">
-                    <a href="/">~</a>/<a>404</a>/
+                    <a href="{{$.Href "."}}">~</a>/<a>404</a>/
                 </header>
                 <div class="card-content">
                     <div class="inner">
                         <div>
-                            go <a href="javascript:window.history.go(-1);">back</a> or go back home on <a href="/">filekeep</a>.
+                            go <a href="javascript:window.history.go(-1);">back</a> or go back home on <a href="{{$.Href "."}}">filekeep</a>.
                         </div>
                         {{if .}}
                             <div>
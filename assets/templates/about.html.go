@@ -2,7 +2,7 @@ package templates
 
 /*
 DO NOT EDIT
-Autogenerated file by `build_assets.sh` at Thu Feb 28 23:01:41 EET 2019.
+Autogenerated file by `build_assets.sh` at Sun Oct 18 17:51:15 UTC 2026.
 */
 
 // HTMLAbout - bundled asset, name should be self explanatory
@@ -12,7 +12,7 @@ const HTMLAbout = `
         <div class="cell -12of12">
             <div class="card">
                 <header class="card-header">
-                    <a href="/">~</a>/<a href="/about">about</a>/
+                    <a href="{{$.Href "."}}">~</a>/<a href="{{$.Href "about"}}">about</a>/
                 </header>
                 <div class="card-content">
                     <div class="inner">
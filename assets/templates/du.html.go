@@ -0,0 +1,57 @@
+package templates
+
+/*
+DO NOT EDIT
+Autogenerated file by `build_assets.sh` at Sun Oct 18 17:51:15 UTC 2026.
+*/
+
+// HTMLDiskUsage - bundled asset, name should be self explanatory
+const HTMLDiskUsage = `
+<div class="container">
+    <div class="grid">
+        <div class="cell -12of12">
+            <div class="card">
+                <header class="card-header">
+                    disk usage of
+                    {{range .Breadcrumbs}}<a href="{{.Path}}">{{.Name}}</a>{{if not (eq .Name "")}}/{{end}}{{end}}
+                    &middot; <strong>{{.Usage.Size}}</strong> in {{.Usage.Files}} file{{if not (eq .Usage.Files 1)}}s{{end}}
+                    and {{.Usage.Dirs}} director{{if eq .Usage.Dirs 1}}y{{else}}ies{{end}}
+                    {{if .Usage.Pending}}<em class="pending">(computing...)</em>{{end}}
+                    &middot; <a href="{{$.Href .Path}}">listing</a>
+                </header>
+                <div class="card-content">
+                    <div class="inner -left">
+                        {{if .Entries}}
+                            <div class="treemap">
+                                {{range $e := .Entries}}{{with .Tile}}
+                                    <a class="tile{{if $e.IsDir}} -dir{{end}}" href="{{$e.Href}}" title="{{$e.Name}}: {{$e.Size}}"
+                                       style="left: {{printf "%.3f" .Left}}%; top: {{printf "%.3f" .Top}}%; width: {{printf "%.3f" .Width}}%; height: {{printf "%.3f" .Height}}%;">
+                                        <span>{{$e.Name}}</span>
+                                    </a>
+                                {{end}}{{end}}
+                            </div>
+
+                            <div class="menu">
+                                {{range .Entries}}
+                                    <a class="menu-item du-entry" href="{{.Href}}">
+                                        <span class="du-bar{{if .IsDir}} -dir{{end}}" style="width: {{printf "%.3f" .Percent}}%;"></span>
+                                        {{.Name}}{{if .IsDir}}/{{end}}
+
+                                        <div class="pull-right">
+                                            {{if .Pending}}<em class="pending">computing...</em>{{end}}
+                                            {{.Size}}
+                                            <span class="du-percent">{{printf "%.1f" .Percent}}%</span>
+                                        </div>
+                                    </a>
+                                {{end}}
+                            </div>
+                        {{else}}
+                            <p>empty directory.</p>
+                        {{end}}
+                    </div>
+                </div>
+            </div>
+        </div>
+    </div>
+</div>
+`
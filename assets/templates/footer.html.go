@@ -2,7 +2,7 @@ package templates
 
 /*
 DO NOT EDIT
-Autogenerated file by `build_assets.sh` at Thu Feb 28 23:01:41 EET 2019.
+Autogenerated file by `build_assets.sh` at Sun Oct 18 17:51:15 UTC 2026.
 */
 
 // HTMLFooter - bundled asset, name should be self explanatory
@@ -13,9 +13,11 @@ const HTMLFooter = `
         <div class="grid -right">
             <div class="-12of12">
                 <div class="footer-links">
-                    <a href="/about">about</a>
+                    <a href="{{$.Href "about"}}">about</a>
+                    {{if not .Static}}
                     |
-                    <a href="/_toggleTheme">toggle theme</a>
+                    <a href="{{$.Href "_toggleTheme"}}">toggle theme</a>
+                    {{end}}
                 </div>
             </div>
         </div>
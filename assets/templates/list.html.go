@@ -2,39 +2,65 @@ package templates
 
 /*
 DO NOT EDIT
-Autogenerated file by `build_assets.sh` at Thu Feb 28 23:01:41 EET 2019.
+Autogenerated file by `build_assets.sh` at Sun Oct 18 17:51:29 UTC 2026.
 */
 
 // HTMLDirList - bundled asset, name should be self explanatory
 const HTMLDirList = `
 <div class="container">
     <div class="grid">
+        {{with $.Readme .Node "header"}}
+        <div class="cell -12of12">
+            <div class="card readme -header">
+                <div class="card-content">{{.}}</div>
+            </div>
+        </div>
+        {{end}}
         <div class="cell -12of12">
             <div class="card">
                 <header class="card-header">
                     listing
-                    <strong>{{.Dirs | len}} director{{if eq (.Dirs | len) 1}}y{{else}}ies{{end}}</strong>
+                    <strong id="dirs-count">{{.Dirs | len}} director{{if eq (.Dirs | len) 1}}y{{else}}ies{{end}}</strong>
                     and
-                    <strong>{{.Files | len}} file{{if not (eq (.Files | len) 1)}}s{{end}}</strong>
-                    {{if .FilesSize}}({{.FilesSize}}){{end}}
+                    <strong id="files-count">{{.Files | len}} file{{if not (eq (.Files | len) 1)}}s{{end}}</strong>
+                    <span id="files-size">{{if .FilesSize}}({{.FilesSize}}){{end}}</span>
+                    {{with .Usage}}
+                        {{if or .Size (not .Pending)}}
+                            &middot; {{.Size}} in {{.Files}} file{{if not (eq .Files 1)}}s{{end}} in total
+                        {{end}}
+                        {{if .Pending}}<em class="pending">(computing the total size...)</em>{{end}}
+                    {{end}}
                     in
-                    {{range breadcrumbs .Path ""}}<a href="{{.Path}}">{{.Name}}</a>{{if not (eq .Name "")}}/{{end}}{{end}}
+                    {{range $.Breadcrumbs .Path ""}}<a href="{{.Path}}">{{.Name}}</a>{{if not (eq .Name "")}}/{{end}}{{end}}
+                    {{if not .InArchive}}
+                        {{with $.Du .Path}}&middot; <a href="{{.}}">disk usage</a>{{end}}
+                        {{with $.Feed .Path}}&middot; <a href="{{.}}" type="application/atom+xml">feed</a>{{end}}
+                    {{end}}
                 </header>
                 <div class="card-content">
                     <div class="inner -left">
                         <div class="menu">
                             {{if .Prev}}
-                                <a class="menu-item" href="{{href .Prev}}">..</a>
+                                <a class="menu-item" href="{{$.Href .Prev}}">..</a>
                             {{end}}
 
                             {{/* Listing the directories */}}
-                            {{if .Dirs | len}}
+                            <div id="dirs"{{if not (.Dirs | len)}} hidden{{end}}>
                                 <div class="menu-header">dirs:</div>
                                 {{range .Dirs}}
-                                    <a class="menu-item" href="{{href .Path}}">
+                                    <a class="menu-item" href="{{$.Href .Path}}" data-name="{{.Name}}">
                                         {{.Name}}
 
                                         <div class="pull-right">
+                                            {{with .Usage}}
+                                                {{if .Pending}}
+                                                    <em class="pending" title="computing the total size">{{if .Size}}{{.Size}}{{else}}computing...{{end}}</em>
+                                                {{else}}
+                                                    <strong title="{{.Files}} files in total">{{.Size}}</strong>
+                                                {{end}}
+                                                &middot;
+                                            {{end}}
+
                                             {{if .Files | len}}
                                                 {{.Files | len}} file{{if gt (.Files | len) 1}}s{{end}}
                                                 ({{.FilesSize}})
@@ -54,27 +80,156 @@ const HTMLDirList = `
                                         </div>
                                     </a>
                                 {{end}}
-                            {{end}}
+                            </div>
 
                             {{/* Listing the files */}}
-                            {{if .Files | len}}
+                            <div id="files"{{if not (.Files | len)}} hidden{{end}}>
                                 <div class="menu-header">files:</div>
                                 {{range .Files}}
-                                    <a class="menu-item" href="{{href .Path}}">
-                                        {{.Name}}
+                                    {{if .IsArchive}}
+                                        <div class="menu-item" data-name="{{.Name}}" data-size="{{printf "%d" .Size}}">
+                                            <a href="{{$.Href .Path}}">{{.Name}}</a>
 
-                                        <div class="pull-right">
-                                            {{.Size}}
+                                            <div class="pull-right">
+                                                <a href="{{$.Href .Path}}/">browse</a>
+                                                &middot;
+                                                {{.Size}}
+                                            </div>
                                         </div>
-                                    </a>
+                                    {{else}}
+                                        <a class="menu-item" href="{{$.Href .Path}}" data-name="{{.Name}}" data-size="{{printf "%d" .Size}}">
+                                            {{.Name}}
+
+                                            <div class="pull-right">
+                                                {{.Size}}
+                                            </div>
+                                        </a>
+                                    {{end}}
                                 {{end}}
-                            {{end}}
+                            </div>
 
                         </div>
                     </div>
                 </div>
             </div>
         </div>
+        {{with $.Readme .Node "footer"}}
+        <div class="cell -12of12">
+            <div class="card readme -footer">
+                <div class="card-content">{{.}}</div>
+            </div>
+        </div>
+        {{end}}
     </div>
 </div>
+
+{{$events := $.Events .Path}}
+{{if and $events (not .InArchive)}}
+<script>
+    // updates the listing as files are created, modified and deleted, without reloading
+    (function () {
+        if (!window.EventSource) {
+            return;
+        }
+
+        function humanSize(b) {
+            var units = ["EB", "PB", "TB", "GB", "MB", "KB"];
+            for (var i = 0; i < units.length; i++) {
+                var unit = Math.pow(1024, units.length - i);
+                if (b > unit) {
+                    return (b / unit).toFixed(1) + " " + units[i];
+                }
+            }
+            return b + " B";
+        }
+
+        function row(data) {
+            var el = document.createElement(data.is_archive ? "div" : "a");
+            el.className = "menu-item";
+            el.dataset.name = data.name;
+            if (!data.is_dir) {
+                el.dataset.size = data.size || 0;
+            }
+
+            var name = document.createElement(data.is_archive ? "a" : "span");
+            name.textContent = data.name;
+            var right = document.createElement("div");
+            right.className = "pull-right";
+            right.textContent = data.is_dir ? "" : data.size_text;
+            if (data.is_archive) {
+                name.href = data.href;
+                var browse = document.createElement("a");
+                browse.href = data.href + "/";
+                browse.textContent = "browse";
+                right.textContent = " \u00b7 " + data.size_text;
+                right.insertBefore(browse, right.firstChild);
+            } else {
+                el.href = data.href;
+            }
+            el.appendChild(name);
+            el.appendChild(right);
+            return el;
+        }
+
+        function find(name) {
+            var items = document.querySelectorAll("#dirs .menu-item, #files .menu-item");
+            for (var i = 0; i < items.length; i++) {
+                if (items[i].dataset.name === name) {
+                    return items[i];
+                }
+            }
+            return null;
+        }
+
+        function insert(section, el) {
+            var items = section.querySelectorAll(".menu-item");
+            for (var i = 0; i < items.length; i++) {
+                if (items[i].dataset.name > el.dataset.name) {
+                    section.insertBefore(el, items[i]);
+                    return;
+                }
+            }
+            section.appendChild(el);
+        }
+
+        function refresh() {
+            var dirs = document.querySelectorAll("#dirs .menu-item").length;
+            var files = document.querySelectorAll("#files .menu-item");
+            var size = 0;
+            for (var i = 0; i < files.length; i++) {
+                size += parseInt(files[i].dataset.size, 10) || 0;
+            }
+            document.getElementById("dirs").hidden = dirs === 0;
+            document.getElementById("files").hidden = files.length === 0;
+            document.getElementById("dirs-count").textContent = dirs + (dirs === 1 ? " directory" : " directories");
+            document.getElementById("files-count").textContent = files.length + (files.length === 1 ? " file" : " files");
+            document.getElementById("files-size").textContent = size ? "(" + humanSize(size) + ")" : "";
+        }
+
+        function update(e) {
+            var data = JSON.parse(e.data);
+            var old = find(data.name);
+            if (e.type === "delete") {
+                if (old) {
+                    old.parentNode.removeChild(old);
+                }
+            } else if (old && data.is_dir && old.parentNode.id === "dirs") {
+                // the listed counts of a directory don't change with its modification time
+                return;
+            } else {
+                if (old) {
+                    old.parentNode.removeChild(old);
+                }
+                insert(document.getElementById(data.is_dir ? "dirs" : "files"), row(data));
+            }
+            refresh();
+        }
+
+        var source = new EventSource({{$events}});
+        ["create", "modify", "delete"].forEach(function (type) {
+            source.addEventListener(type, update);
+        });
+    })();
+</script>
+{{end}}
 `
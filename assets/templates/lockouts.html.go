@@ -0,0 +1,52 @@
+package templates
+
+/*
+DO NOT EDIT
+Autogenerated file by `build_assets.sh` at Sun Oct 18 17:51:15 UTC 2026.
+*/
+
+// HTMLLockouts - bundled asset, name should be self explanatory
+const HTMLLockouts = `
+<div class="container">
+    <div class="grid">
+        <div class="cell -12of12">
+            <div class="card">
+                <header class="card-header">
+                    <a href="{{$.Href "."}}">~</a>/<a>lockouts</a>/
+                </header>
+                <div class="card-content">
+                    <div class="inner -left">
+                        {{range $name, $statuses := .Guards}}
+                            <h3>by {{$name}}:</h3>
+                            {{if $statuses}}
+                                <table>
+                                    <thead>
+                                    <tr>
+                                        <th>{{$name}}</th>
+                                        <th>failures</th>
+                                        <th>last failure</th>
+                                        <th>locked until</th>
+                                    </tr>
+                                    </thead>
+                                    <tbody>
+                                    {{range $statuses}}
+                                        <tr>
+                                            <td>{{.Key}}</td>
+                                            <td>{{.Failures}}</td>
+                                            <td>{{.LastFailure.Format "2006-01-02 15:04:05"}}</td>
+                                            <td>{{if .Locked $.Now}}<strong>{{.LockedUntil.Format "2006-01-02 15:04:05"}}</strong>{{else}}-{{end}}</td>
+                                        </tr>
+                                    {{end}}
+                                    </tbody>
+                                </table>
+                            {{else}}
+                                <p>no failed attempts.</p>
+                            {{end}}
+                        {{end}}
+                    </div>
+                </div>
+            </div>
+        </div>
+    </div>
+</div>
+`
@@ -0,0 +1,220 @@
+// Package audit implements an append-only log of security relevant events, where every entry
+// is chained to the previous one by a SHA-256 hash, so that edits and removals can be detected.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The types of the recorded events.
+const (
+	Password     = "password"
+	Upload       = "upload"
+	Delete       = "delete"
+	Move         = "move"
+	Extract      = "extract"
+	Compress     = "compress"
+	ConfigReload = "config_reload"
+)
+
+// Entry is a single event of the audit log.
+type Entry struct {
+	// Seq is the position of the entry in the log, starting at 1.
+	Seq uint64 `json:"seq"`
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+	// Type is the kind of event, e.g. Password.
+	Type string `json:"type"`
+	// Site is the host name of the site the event happened on, empty for the main one.
+	Site string `json:"site,omitempty"`
+	// Path is the path the event happened on, relative to the root.
+	Path string `json:"path,omitempty"`
+	// Client is the address of the client causing the event.
+	Client string `json:"client,omitempty"`
+	// User is the name of the API token used, if any.
+	User string `json:"user,omitempty"`
+	// Success tells if the attempt succeeded, e.g. if the password was correct.
+	Success bool `json:"success"`
+	// Detail holds additional information, like an error message.
+	Detail string `json:"detail,omitempty"`
+	// Prev is the hash of the previous entry, empty for the first one.
+	Prev string `json:"prev"`
+	// Hash is the SHA-256 sum of the previous hash and this entry, without its hash.
+	Hash string `json:"hash"`
+}
+
+// sum returns the hash of the entry, chained to its previous hash.
+func (e Entry) sum() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	h := sha256.New()
+	h.Write([]byte(e.Prev))
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Log is an append-only audit log file, safe for concurrent use.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	seq  uint64
+	last string
+}
+
+// Open opens the audit log at path for appending, creating it if needed. The existing entries
+// are verified, so new ones continue the hash chain.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open audit log: %s", err)
+	}
+
+	l := &Log{f: f}
+	err = Read(f, func(e *Entry) error {
+		l.seq, l.last = e.Seq, e.Hash
+		return nil
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends the event e to the log, filling in its sequence number, time and hashes.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Seq = l.seq + 1
+	e.Prev = l.last
+	e.Hash = e.sum()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("couldn't write audit log: %s", err)
+	}
+
+	l.seq, l.last = e.Seq, e.Hash
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// ChainError is returned by Read if an entry doesn't match the hash chain.
+type ChainError struct {
+	Line   int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit log tampered with at line %d: %s", e.Line, e.Reason)
+}
+
+// Read reads all entries from r, verifying the hash chain, and calls fn for each of them.
+// It stops at the first error returned by fn or found in the chain.
+func Read(r io.Reader, fn func(*Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var (
+		line int
+		seq  uint64
+		last string
+	)
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		e := new(Entry)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return &ChainError{line, fmt.Sprintf("invalid entry: %s", err)}
+		}
+		switch {
+		case e.Seq != seq+1:
+			return &ChainError{line, fmt.Sprintf("expected sequence %d, got %d", seq+1, e.Seq)}
+		case e.Prev != last:
+			return &ChainError{line, "previous hash doesn't match"}
+		case e.Hash != e.sum():
+			return &ChainError{line, "hash doesn't match the entry"}
+		}
+		seq, last = e.Seq, e.Hash
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("couldn't read audit log: %s", err)
+	}
+	return nil
+}
+
+// Filter selects entries of the log. Zero fields match everything.
+type Filter struct {
+	// Site matches entries of the site, by host name.
+	Site string
+	// Path matches entries on the path, or under it if it's a directory.
+	Path string
+	// Client matches entries caused by the client address.
+	Client string
+	// Type matches entries of the type.
+	Type string
+	// Since matches entries recorded at or after it.
+	Since time.Time
+	// Until matches entries recorded before it.
+	Until time.Time
+}
+
+// Match returns whether the entry e is selected by the filter.
+func (f Filter) Match(e *Entry) bool {
+	if f.Site != "" && e.Site != f.Site {
+		return false
+	}
+	if f.Path != "" {
+		p := strings.TrimRight(f.Path, "/")
+		if e.Path != p && !strings.HasPrefix(e.Path, p+"/") {
+			return false
+		}
+	}
+	if f.Client != "" && e.Client != f.Client {
+		return false
+	}
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
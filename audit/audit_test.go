@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(Entry{Type: Password, Path: "/secret.txt", Client: "192.0.2.1"})
+	l.Close()
+
+	// reopening continues the chain
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(Entry{Type: Password, Path: "/secret.txt", Client: "192.0.2.1", Success: true})
+	l.Record(Entry{Type: Upload, Path: "/dir/new.txt", User: "ci", Success: true})
+	l.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var matched []*Entry
+	filter := Filter{Path: "/secret.txt", Client: "192.0.2.1"}
+	err = Read(bytes.NewReader(b), func(e *Entry) error {
+		if filter.Match(e) {
+			matched = append(matched, e)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 2 || matched[0].Success || !matched[1].Success || matched[1].Seq != 2 {
+		t.Errorf("unexpected entries %+v", matched)
+	}
+
+	tests := []struct {
+		name     string
+		tampered string
+	}{
+		{"edited", strings.Replace(string(b), `"success":false`, `"success":true`, 1)},
+		{"removed", string(b[bytes.IndexByte(b, '\n')+1:])},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Read(strings.NewReader(test.tampered), func(*Entry) error { return nil })
+			if _, ok := err.(*ChainError); !ok {
+				t.Errorf("expected a ChainError, got %v", err)
+			}
+		})
+	}
+}
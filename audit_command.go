@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"filekeep/audit"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// parseTime parses an absolute time in RFC 3339 or as a date, or a duration before now.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339, a date, or a duration", s)
+}
+
+// auditCommand prints the entries of the audit log matching the flags in args, and returns the exit code.
+func auditCommand(args []string) int {
+	flags := newFlagSet("audit", "[flags]")
+	file := flags.String("file", "", "path to the audit log, defaults to the one in the config")
+	site := flags.String("site", "", "only show events of the site with this host name")
+	path := flags.String("path", "", "only show events on this path, or under it")
+	client := flags.String("client", "", "only show events caused by this client address")
+	typ := flags.String("type", "", "only show events of this type: password, upload, delete or config_reload")
+	since := flags.String("since", "", "only show events since this time, in RFC 3339, as a date, or a duration ago like 24h")
+	until := flags.String("until", "", "only show events before this time, in the same formats as -since")
+	asJSON := flags.Bool("json", false, "print the entries as JSON lines")
+	verify := flags.Bool("verify", false, "only verify the hash chain of the log")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		logConfigError(err)
+		return exitFailure
+	}
+
+	if *file == "" {
+		*file = c.AuditLog
+	}
+	if *file == "" {
+		logrus.Error("no audit log configured, use -file")
+		return exitUsage
+	}
+
+	filter := audit.Filter{Site: *site, Path: *path, Client: *client, Type: *typ}
+	var err error
+	if filter.Since, err = parseTime(*since); err != nil {
+		logrus.WithError(err).Error("invalid -since")
+		return exitUsage
+	}
+	if filter.Until, err = parseTime(*until); err != nil {
+		logrus.WithError(err).Error("invalid -until")
+		return exitUsage
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		logrus.WithError(err).Error("couldn't open audit log")
+		return exitFailure
+	}
+	defer f.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	enc := json.NewEncoder(os.Stdout)
+	count := 0
+
+	err = audit.Read(f, func(e *audit.Entry) error {
+		count++
+		if *verify || !filter.Match(e) {
+			return nil
+		}
+		if *asJSON {
+			return enc.Encode(e)
+		}
+
+		result, user := "ok", e.User
+		if !e.Success {
+			result = "FAILED"
+		}
+		if user == "" {
+			user = "-"
+		}
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Format(time.RFC3339), e.Type, result, e.Client, user, e.Site+e.Path, e.Detail)
+		return err
+	})
+	w.Flush()
+
+	if err != nil {
+		logrus.WithError(err).Error("couldn't read audit log")
+		return exitFailure
+	}
+
+	if *verify {
+		logrus.WithField("entries", count).Info("audit log hash chain is intact")
+	}
+	return exitOK
+}
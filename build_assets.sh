@@ -53,6 +53,8 @@ FILES=(
     templates:footer.html:HTMLFooter
     templates:about.html:HTMLAbout
     templates:pass.html:HTMLPassForm
+    templates:lockouts.html:HTMLLockouts
+    templates:du.html:HTMLDiskUsage
 )
 
 for F in "${FILES[@]}"
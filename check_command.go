@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/hex"
+	"filekeep/audit"
+	"filekeep/config"
+	"filekeep/fs"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checker prints the results of the diagnostics, and remembers the failures.
+type checker struct {
+	failed bool
+}
+
+func (ch *checker) ok(name, format string, args ...interface{}) {
+	fmt.Printf("ok    %-12s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (ch *checker) warn(name, format string, args ...interface{}) {
+	fmt.Printf("WARN  %-12s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (ch *checker) fail(name, format string, args ...interface{}) {
+	ch.failed = true
+	fmt.Printf("FAIL  %-12s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+// checkCommand diagnoses the config and the environment filekeep runs in, and returns the exit code,
+// exitFailure if anything would keep it from serving as configured.
+func checkCommand(args []string) int {
+	flags := newFlagSet("check", "")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	ch := new(checker)
+	if err := loadConfig(); err != nil {
+		problems, ok := err.(config.Problems)
+		if !ok {
+			problems = config.Problems{{Message: err.Error()}}
+		}
+		for _, p := range problems {
+			ch.fail("config", "%s", p)
+		}
+		return exitFailure
+	}
+	if *configFlag == "" {
+		ch.warn("config", "no config file, using the defaults")
+	} else {
+		ch.ok("config", "loaded %s", *configFlag)
+	}
+
+	checkFiles(ch, "", c.Root, c.Mounts)
+	hosts := make([]string, 0, len(c.Sites))
+	for host := range c.Sites {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		checkFiles(ch, host, c.Sites[host].Root, c.Sites[host].Mounts)
+	}
+
+	checkListen(ch, "web", c.Web.String())
+	if c.Admin.Port != 0 {
+		checkListen(ch, "admin", c.Admin.String())
+	}
+
+	if c.AccessLog.Path != "-" {
+		checkWritable(ch, "access_log", c.AccessLog.Path)
+	}
+	checkWritable(ch, "audit_log", c.AuditLog)
+	checkWritable(ch, "webhooks", c.Webhooks.Queue)
+	checkWritable(ch, "webhooks", c.Webhooks.Log)
+	checkAuditLog(ch, c.AuditLog)
+
+	if len(c.Tokens) == 0 {
+		ch.warn("tokens", "no API tokens, uploads, deletions and jobs are disabled")
+	}
+	for name, token := range c.Tokens {
+		if token != "" && len(token) < 16 {
+			ch.warn("tokens", "the token %q is shorter than 16 characters", name)
+		}
+	}
+
+	if ch.failed {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// checkListen checks the address is free to listen on.
+func checkListen(ch *checker, name, addr string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		ch.fail(name, "couldn't listen on %s, is filekeep already running? %s", addr, err)
+		return
+	}
+	l.Close()
+	ch.ok(name, "can listen on %s", addr)
+}
+
+// checkWritable checks a file can be created in the directory of path, if set.
+func checkWritable(ch *checker, name, path string) {
+	if path == "" {
+		return
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".filekeep-check-")
+	if err != nil {
+		ch.fail(name, "couldn't write next to %s: %s", path, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	ch.ok(name, "can write %s", path)
+}
+
+// checkAuditLog verifies the hash chain of the audit log, if any.
+func checkAuditLog(ch *checker, path string) {
+	if path == "" {
+		return
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		ch.fail("audit_log", "couldn't open %s: %s", path, err)
+		return
+	}
+	defer f.Close()
+
+	count := 0
+	if err := audit.Read(f, func(*audit.Entry) error { count++; return nil }); err != nil {
+		ch.fail("audit_log", "%s", err)
+		return
+	}
+	ch.ok("audit_log", "the hash chain of %d entries is intact", count)
+}
+
+// checkFiles checks that the root directory and the mounts of the site can be listed, and their password
+// files. The site is the host name of the site, empty for the root.
+func checkFiles(ch *checker, site, root string, mounts []config.Mount) {
+	if site != "" {
+		site += ": "
+	}
+	if _, err := ioutil.ReadDir(root); err != nil {
+		ch.fail("root", "%scouldn't list the root directory: %s", site, err)
+	} else {
+		ch.ok("root", "%s%s", site, root)
+		checkPasswordFiles(ch, root)
+	}
+	for _, m := range mounts {
+		if _, err := ioutil.ReadDir(m.Path); err != nil {
+			ch.fail("mounts", "%scouldn't list the directory of %q: %s", site, m.Name, err)
+			continue
+		}
+		mode := "read-write"
+		if m.ReadOnly {
+			mode = "read-only"
+		}
+		ch.ok("mounts", "%s/%s: %s, %s", site, m.Name, m.Path, mode)
+		checkPasswordFiles(ch, m.Path)
+	}
+}
+
+// checkPasswordFiles warns about the password files under root not holding a MD5 sum, which no
+// password matches.
+func checkPasswordFiles(ch *checker, root string) {
+	count := 0
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		protected := filepath.Join(filepath.Dir(path), strings.TrimPrefix(info.Name(), "."))
+		if _, err := os.Stat(protected); err != nil || fs.PasswordFile(protected) != path {
+			return nil
+		}
+
+		count++
+		b, err := ioutil.ReadFile(path)
+		sum := strings.TrimSpace(string(b))
+		if _, hexErr := hex.DecodeString(sum); err != nil || len(sum) != 32 || hexErr != nil {
+			ch.warn("passwords", "%s doesn't hold a MD5 sum, use filekeep passwd set", path)
+		}
+		return nil
+	})
+	ch.ok("passwords", "%d protected files and directories", count)
+}
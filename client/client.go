@@ -0,0 +1,437 @@
+// Package client implements a Go client for the filekeep HTTP API.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"filekeep/fs"
+	"filekeep/jobs"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested path doesn't exist or is hidden.
+	ErrNotFound = errors.New("not found")
+	// ErrPasswordRequired is returned when a protected path is requested without its correct password.
+	ErrPasswordRequired = errors.New("password required")
+	// ErrForbidden is returned when an operation needs a valid API token.
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotDir is returned by List if the path is a file.
+	ErrNotDir = errors.New("not a directory")
+)
+
+// Error is returned for unexpected server responses.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("filekeep: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("filekeep: unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// Client talks to a filekeep server.
+type Client struct {
+	// BaseURL is the address of the server, e.g. http://localhost:8080.
+	BaseURL *url.URL
+	// HTTPClient is used to make all requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Token is the API token sent as a bearer token with every request, if set.
+	Token string
+
+	mu        sync.Mutex
+	passwords map[string]string
+}
+
+// New returns a Client for the server at baseURL.
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse base URL: %s", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q must be absolute", baseURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	return &Client{BaseURL: u, passwords: make(map[string]string)}, nil
+}
+
+// SetPassword sets the password sent when requesting the protected path p.
+// An empty password removes it.
+func (c *Client) SetPassword(p, password string) {
+	p = cleanPath(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if password == "" {
+		delete(c.passwords, p)
+		return
+	}
+	c.passwords[p] = password
+}
+
+func (c *Client) password(p string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.passwords[cleanPath(p)]
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+func (c *Client) url(p string, query url.Values) string {
+	u := *c.BaseURL
+	u.Path = c.BaseURL.Path + cleanPath(p)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// newRequest builds a request for the path p. Protected paths are requested with POST,
+// carrying their password in the form body, the same way the web form does.
+func (c *Client) newRequest(method, p string, query url.Values, body io.Reader) (*http.Request, error) {
+	pass := c.password(p)
+	if method == http.MethodGet && pass != "" {
+		method = http.MethodPost
+		body = strings.NewReader(url.Values{"password": {pass}}.Encode())
+	}
+
+	req, err := http.NewRequest(method, c.url(p, query), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if method == http.MethodPost && pass != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request, ok ...int) (*http.Response, error) {
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range ok {
+		if res.StatusCode == code {
+			return res, nil
+		}
+	}
+
+	defer res.Body.Close()
+	return nil, responseError(res)
+}
+
+func responseError(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnauthorized:
+		return ErrPasswordRequired
+	case http.StatusForbidden:
+		return ErrForbidden
+	}
+
+	e := &Error{StatusCode: res.StatusCode}
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt == "application/json" {
+		var body struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err == nil {
+			e.Message = body.Message
+		}
+	}
+	return e
+}
+
+// Stat returns the node for the path p. Directories include their children.
+func (c *Client) Stat(p string) (*fs.Node, error) {
+	req, err := c.newRequest(http.MethodGet, p, url.Values{"json": {""}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	n := new(fs.Node)
+	if err := json.NewDecoder(res.Body).Decode(n); err != nil {
+		return nil, fmt.Errorf("couldn't decode node: %s", err)
+	}
+	return n, nil
+}
+
+// List returns the directory at path p, along with its children files and directories.
+func (c *Client) List(p string) (*fs.Node, error) {
+	n, err := c.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsDir {
+		return nil, ErrNotDir
+	}
+	return n, nil
+}
+
+// Download writes the contents of the file at path p to w, returning the number of bytes written.
+func (c *Client) Download(p string, w io.Writer) (int64, error) {
+	return c.DownloadRange(p, 0, -1, w)
+}
+
+// DownloadRange writes length bytes of the file at path p, starting at offset, to w.
+// A negative length reads until the end of the file.
+func (c *Client) DownloadRange(p string, offset, length int64, w io.Writer) (int64, error) {
+	if length == 0 {
+		return 0, nil
+	}
+
+	res, err := c.get(p, offset, length)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK && (offset > 0 || length >= 0) {
+		// the server ignored the range, skip to the requested part ourselves
+		if _, err := io.CopyN(ioutil.Discard, res.Body, offset); err != nil {
+			return 0, err
+		}
+		if length >= 0 {
+			return io.CopyN(w, res.Body, length)
+		}
+	}
+	return io.Copy(w, res.Body)
+}
+
+func (c *Client) get(p string, offset, length int64) (*http.Response, error) {
+	req, err := c.newRequest(http.MethodGet, p, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case length >= 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	return c.do(req, http.StatusOK, http.StatusPartialContent)
+}
+
+// DownloadFile downloads the file at path p to the local file dest. If dest already exists,
+// the download resumes from its current size. It returns the number of bytes written.
+func (c *Client) DownloadFile(p, dest string) (int64, error) {
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := info.Size()
+	res, err := c.get(p, offset, -1)
+	if e, ok := err.(*Error); ok && e.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// nothing left to download
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		// the server sent the whole file, start over
+		offset = 0
+		if err := f.Truncate(0); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, res.Body)
+	if err != nil {
+		return n, err
+	}
+	return n, f.Close()
+}
+
+// Upload writes the contents of r to the file at path p, replacing it if it exists.
+// Uploading requires an API token.
+func (c *Client) Upload(p string, r io.Reader) (*fs.Node, error) {
+	req, err := c.newRequest(http.MethodPut, p, nil, r)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		Raw *fs.Node `json:"raw"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("couldn't decode node: %s", err)
+	}
+	return body.Raw, nil
+}
+
+// Delete removes the file or empty directory at path p. With recursive set, directories are
+// removed along with their contents, unless they hold hidden or protected files. Deleting requires an API token.
+func (c *Client) Delete(p string, recursive bool) error {
+	var query url.Values
+	if recursive {
+		query = url.Values{"recursive": {""}}
+	}
+
+	req, err := c.newRequest(http.MethodDelete, p, query, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Move moves or renames the file or directory at path p to dest, which mustn't exist, and returns its node.
+// Moving requires an API token.
+func (c *Client) Move(p, dest string) (*fs.Node, error) {
+	req, err := c.newRequest("MOVE", p, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Destination", c.BaseURL.Path+cleanPath(dest))
+
+	res, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		Raw *fs.Node `json:"raw"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("couldn't decode node: %s", err)
+	}
+	return body.Raw, nil
+}
+
+// jobRequest sends a request of the jobs API at path p with the JSON encoding of body, if not nil,
+// and decodes the job status of the response.
+func (c *Client) jobRequest(method, p string, body interface{}, ok int) (*jobs.Status, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := c.newRequest(method, "/_jobs"+cleanPath(p), nil, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.do(req, ok)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var raw struct {
+		Raw *jobs.Status `json:"raw"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("couldn't decode job: %s", err)
+	}
+	return raw.Raw, nil
+}
+
+// Extract starts extracting the archive at path p into the directory dest, which mustn't exist.
+// An empty dest extracts next to the archive, into a directory named after it. Extracting requires
+// an API token, and runs in the background: use Wait to wait for the job to end.
+func (c *Client) Extract(p, dest string) (*jobs.Status, error) {
+	body := map[string]string{"archive": cleanPath(p), "dest": dest}
+	return c.jobRequest(http.MethodPost, "/extract", body, http.StatusAccepted)
+}
+
+// Compress starts compressing the files and directories at paths into the new archive dest, its type chosen
+// from its extension. Compressing requires an API token, and runs in the background: use Wait to wait
+// for the job to end.
+func (c *Client) Compress(paths []string, dest string) (*jobs.Status, error) {
+	body := map[string]interface{}{"paths": paths, "dest": dest}
+	return c.jobRequest(http.MethodPost, "/compress", body, http.StatusAccepted)
+}
+
+// Job returns the status of the job with the id.
+func (c *Client) Job(id string) (*jobs.Status, error) {
+	return c.jobRequest(http.MethodGet, id, nil, http.StatusOK)
+}
+
+// CancelJob cancels the job with the id, if it didn't end yet.
+func (c *Client) CancelJob(id string) (*jobs.Status, error) {
+	return c.jobRequest(http.MethodPost, id+"/cancel", nil, http.StatusOK)
+}
+
+// Wait polls the status of the job with the id every interval until it ends. It returns an error
+// if the job failed or was cancelled.
+func (c *Client) Wait(id string, interval time.Duration) (*jobs.Status, error) {
+	for {
+		s, err := c.Job(id)
+		if err != nil {
+			return nil, err
+		}
+		switch s.State {
+		case jobs.Done:
+			return s, nil
+		case jobs.Failed, jobs.Cancelled:
+			return s, fmt.Errorf("job %s %s: %s", id, s.State, s.Error)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,319 @@
+package client
+
+import (
+	"bytes"
+	"filekeep/config"
+	"filekeep/web"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func newTestServer(t *testing.T) *Client {
+	root, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"file.txt":        content,
+		"dir/nested.txt":  "nested",
+		"secret.txt":      "secret",
+		".secret.txt":     "81dc9bdb52d04dc20036dbd8313ed055", // md5 of 1234
+		"dir/.hidden.txt": "hidden",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := config.Get()
+	oldRoot, oldTokens := c.Root, c.Tokens
+	c.Root = root
+	c.Tokens = map[string]string{"test": "s3cret"}
+
+	server := httptest.NewServer(web.NewServer().Handler)
+	t.Cleanup(func() {
+		server.Close()
+		c.Root, c.Tokens = oldRoot, oldTokens
+		os.RemoveAll(root)
+	})
+
+	client, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestList(t *testing.T) {
+	c := newTestServer(t)
+
+	n, err := c.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Dirs) != 1 || n.Dirs[0].Name != "dir" {
+		t.Errorf("expected one directory named dir, got %v", n.Dirs)
+	}
+	if len(n.Files) != 2 {
+		t.Errorf("expected two visible files, got %d", len(n.Files))
+	}
+
+	n, err = c.List("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Files) != 1 || n.Files[0].Name != "nested.txt" {
+		t.Errorf("expected hidden file to be filtered, got %v", n.Files)
+	}
+
+	if _, err := c.List("file.txt"); err != ErrNotDir {
+		t.Errorf("expected ErrNotDir, got %v", err)
+	}
+	if _, err := c.List("missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStat(t *testing.T) {
+	c := newTestServer(t)
+
+	n, err := c.Stat("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.IsDir || n.Name != "file.txt" || int64(n.Size) != int64(len(content)) {
+		t.Errorf("unexpected node %+v", n)
+	}
+
+	if _, err := c.Stat("dir/.hidden.txt"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for hidden file, got %v", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	c := newTestServer(t)
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		expected       string
+	}{
+		{"whole", 0, -1, content},
+		{"range", 10, 5, content[10:15]},
+		{"tail", 30, -1, content[30:]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := c.DownloadRange("file.txt", test.offset, test.length, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != test.expected || n != int64(len(test.expected)) {
+				t.Errorf("expected %q, got %q (%d bytes)", test.expected, buf.String(), n)
+			}
+		})
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	c := newTestServer(t)
+
+	dir, err := ioutil.TempDir("", "filekeep-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(dest, []byte(content[:12]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.DownloadFile("file.txt", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)-12) {
+		t.Errorf("expected to resume with %d bytes, got %d", len(content)-12, n)
+	}
+
+	b, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Errorf("expected %q, got %q", content, b)
+	}
+
+	if n, err := c.DownloadFile("file.txt", dest); err != nil || n != 0 {
+		t.Errorf("expected completed download to be a no-op, got %d, %v", n, err)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	c := newTestServer(t)
+
+	var buf bytes.Buffer
+	if _, err := c.Download("secret.txt", &buf); err != ErrPasswordRequired {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+
+	c.SetPassword("secret.txt", "wrong")
+	if _, err := c.Stat("secret.txt"); err != ErrPasswordRequired {
+		t.Fatalf("expected ErrPasswordRequired for wrong password, got %v", err)
+	}
+
+	c.SetPassword("/secret.txt", "1234")
+	if _, err := c.DownloadRange("secret.txt", 2, 3, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "cre" {
+		t.Errorf("expected %q, got %q", "cre", buf.String())
+	}
+
+	c.SetPassword("secret.txt", "")
+	c.Token = "s3cret"
+	if _, err := c.Stat("secret.txt"); err != nil {
+		t.Errorf("expected token to bypass password, got %v", err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	c := newTestServer(t)
+
+	if _, err := c.Upload("dir/new.txt", strings.NewReader("new")); err != ErrForbidden {
+		t.Fatalf("expected ErrForbidden without token, got %v", err)
+	}
+
+	c.Token = "s3cret"
+	n, err := c.Upload("dir/new.txt", strings.NewReader("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Name != "new.txt" || n.Size != 3 {
+		t.Errorf("unexpected node %+v", n)
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.Download("dir/new.txt", &buf); err != nil || buf.String() != "new" {
+		t.Errorf("expected uploaded content, got %q, %v", buf.String(), err)
+	}
+
+	if _, err := c.Upload("missing/new.txt", strings.NewReader("new")); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for missing parent, got %v", err)
+	}
+	if _, err := c.Upload("dir/.hidden.txt", strings.NewReader("new")); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for hidden file, got %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c := newTestServer(t)
+
+	if err := c.Delete("file.txt", false); err != ErrForbidden {
+		t.Fatalf("expected ErrForbidden without token, got %v", err)
+	}
+
+	c.Token = "s3cret"
+	if err := c.Delete("file.txt", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Stat("file.txt"); err != ErrNotFound {
+		t.Errorf("expected deleted file to be gone, got %v", err)
+	}
+
+	if err, ok := c.Delete("dir", false).(*Error); !ok || err.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict deleting a non-empty directory, got %v", err)
+	}
+	if err, ok := c.Delete("dir", true).(*Error); !ok || err.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict deleting a directory holding a hidden file, got %v", err)
+	}
+	if err := c.Delete("dir/nested.txt", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("/", true); err == nil {
+		t.Error("expected deleting the root to fail")
+	}
+}
+
+func TestMove(t *testing.T) {
+	c := newTestServer(t)
+
+	if _, err := c.Move("file.txt", "dir/moved.txt"); err != ErrForbidden {
+		t.Fatalf("expected ErrForbidden without token, got %v", err)
+	}
+
+	c.Token = "s3cret"
+	n, err := c.Move("file.txt", "dir/moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Name != "moved.txt" || int64(n.Size) != int64(len(content)) {
+		t.Errorf("unexpected moved node %+v", n)
+	}
+	if _, err := c.Stat("file.txt"); err != ErrNotFound {
+		t.Errorf("expected the moved file to be gone, got %v", err)
+	}
+
+	_, err = c.Move("secret.txt", "dir/moved.txt")
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict moving over an existing file, got %v", err)
+	}
+	if _, err := c.Move("dir", "dir/inside"); err == nil {
+		t.Error("expected moving a directory into itself to fail")
+	}
+}
+
+func TestJobs(t *testing.T) {
+	conf := config.Get()
+	conf.Jobs.Enabled = true
+	t.Cleanup(func() { conf.Jobs.Enabled = false })
+	c := newTestServer(t)
+
+	if _, err := c.Compress([]string{"/dir", "/file.txt"}, "/out.zip"); err != ErrForbidden {
+		t.Errorf("expected ErrForbidden without a token, got %v", err)
+	}
+
+	c.Token = "s3cret"
+	s, err := c.Compress([]string{"/dir", "/file.txt"}, "/out.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = c.Wait(s.ID, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if s.Result != "/out.zip" || s.Files != 2 || s.Bytes != s.TotalBytes {
+		t.Errorf("unexpected status of the compression %+v", s)
+	}
+
+	if _, err := c.Compress([]string{"/dir"}, "/out.zip"); err == nil {
+		t.Error("expected an existing destination to be refused")
+	}
+
+	s, err = c.Extract("/out.zip", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = c.Wait(s.ID, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := c.Download(s.Result+"/dir/nested.txt", buf); err != nil || buf.String() != "nested" {
+		t.Errorf("expected the extracted file, got %q, %v", buf, err)
+	}
+}
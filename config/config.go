@@ -1,43 +1,310 @@
 package config
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/go-yaml/yaml"
 )
 
 type web struct {
 	Address string `yaml:"address"`
 	Port    uint16 `yaml:"port"`
+	// BasePath is the URL path filekeep is served at behind a reverse proxy, e.g. "/filekeep".
+	BasePath string `yaml:"base_path"`
 }
 
 func (l web) String() string {
 	return fmt.Sprintf("%s:%d", l.Address, l.Port)
 }
 
+type admin struct {
+	Address string `yaml:"address"`
+	Port    uint16 `yaml:"port"`
+}
+
+func (l admin) String() string {
+	return fmt.Sprintf("%s:%d", l.Address, l.Port)
+}
+
+type accessLog struct {
+	// Path is the file the access log is written to. Empty disables the access log, "-" writes to stdout.
+	Path string `yaml:"path"`
+	// Format is either "combined", the Apache combined log format, or "json".
+	Format string `yaml:"format"`
+	// MaxSize is the size after which the file gets rotated, e.g. 100MB. 0 disables rotation by size.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+	// MaxAge is the age after which the file gets rotated, e.g. 24h. 0 disables rotation by age.
+	MaxAge time.Duration `yaml:"max_age"`
+	// MaxBackups is the number of rotated files kept. 0 keeps all of them.
+	MaxBackups int `yaml:"max_backups"`
+}
+
+// LockoutPolicy defines when and for how long clients or paths get locked out after wrong passwords.
+type LockoutPolicy struct {
+	// Attempts is the number of wrong passwords allowed before locking out. 0 disables the lockouts.
+	Attempts int `yaml:"attempts"`
+	// Lockout is the duration of the first lockout, doubled by every further wrong password.
+	Lockout time.Duration `yaml:"lockout"`
+	// MaxLockout caps the duration of a lockout.
+	MaxLockout time.Duration `yaml:"max_lockout"`
+	// ResetAfter is how long after the last wrong password the failures are forgotten.
+	ResetAfter time.Duration `yaml:"reset_after"`
+}
+
+type bruteForce struct {
+	// IP is the policy for each client address.
+	IP LockoutPolicy `yaml:"ip"`
+	// Path is the policy for each protected path, whatever the client.
+	Path LockoutPolicy `yaml:"path"`
+}
+
+type rateLimit struct {
+	// Requests is the number of requests per second allowed for each client address. 0 disables the limit.
+	Requests float64 `yaml:"requests"`
+	// Burst is the number of requests a client may send at once. Defaults to Requests.
+	Burst int `yaml:"burst"`
+}
+
+type bandwidth struct {
+	// Global caps the bytes per second of all downloads together, e.g. 10MB. 0 disables the cap.
+	Global datasize.ByteSize `yaml:"global"`
+	// PerIP caps the bytes per second of the downloads of each client address.
+	PerIP datasize.ByteSize `yaml:"per_ip"`
+	// Paths caps the bytes per second of all downloads under a path prefix, e.g. "/isos": 1MB.
+	Paths map[string]datasize.ByteSize `yaml:"paths"`
+}
+
+type compression struct {
+	// Enabled compresses the responses with brotli, zstd or gzip, as accepted by the client.
+	Enabled bool `yaml:"enabled"`
+	// MinSize is the size under which responses aren't compressed.
+	MinSize datasize.ByteSize `yaml:"min_size"`
+	// Types are the compressed media types, like "application/json", or "text/*" for all text types.
+	Types []string `yaml:"types"`
+	// Precompressed serves the .br, .zst or .gz sibling of a file instead of it, if present.
+	Precompressed bool `yaml:"precompressed"`
+}
+
+type dirSizes struct {
+	// Enabled computes the recursive sizes of directories in the background.
+	Enabled bool `yaml:"enabled"`
+	// MaxAge is how long a computed size is shown before it's computed again, as changes deep
+	// in a directory don't change its modification time. 0 only computes it again when it does.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+type checksums struct {
+	// CacheSize is the number of file checksums cached.
+	CacheSize int `yaml:"cache_size"`
+	// DigestMaxSize is the size up to which downloads get a Repr-Digest header computed for them, 0 for none.
+	DigestMaxSize datasize.ByteSize `yaml:"digest_max_size"`
+}
+
+type archives struct {
+	// Enabled browses inside ZIP and tar archives like directories.
+	Enabled bool `yaml:"enabled"`
+	// MaxSize is the size over which archives aren't browsable. 0 disables the limit.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+	// MaxMembers is the number of members over which archives aren't browsable. 0 disables the limit.
+	MaxMembers int `yaml:"max_members"`
+	// MaxMemberSize is the size over which archive members can't be downloaded. 0 disables the limit.
+	MaxMemberSize datasize.ByteSize `yaml:"max_member_size"`
+}
+
+type jobs struct {
+	// Enabled allows API token holders to extract and compress archives on the server.
+	Enabled bool `yaml:"enabled"`
+	// Workers is the number of jobs run at the same time, the others wait for their turn.
+	Workers int `yaml:"workers"`
+	// Keep is how long ended jobs can still be looked up.
+	Keep time.Duration `yaml:"keep"`
+	// MaxSize is the total size of the files a job may write. 0 disables the limit.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+	// MaxFiles is the number of files a job may write. 0 disables the limit.
+	MaxFiles int `yaml:"max_files"`
+}
+
+type feeds struct {
+	// Enabled serves the most recent files under directories as feeds, with ?feed=atom or ?feed=rss.
+	Enabled bool `yaml:"enabled"`
+	// Depth is the number of levels of subdirectories looked into.
+	Depth int `yaml:"depth"`
+	// Limit is the number of files listed.
+	Limit int `yaml:"limit"`
+}
+
+type readme struct {
+	// Enabled renders the header and footer files of directories around their listings.
+	Enabled bool `yaml:"enabled"`
+	// Header are the names of the files rendered above the listings, the first one found wins.
+	// Markdown files, ending in .md or .markdown, are rendered without their HTML, the others as plain text.
+	Header []string `yaml:"header"`
+	// Footer are the names of the files rendered below the listings, the first one found wins.
+	Footer []string `yaml:"footer"`
+	// MaxSize is the size of the biggest file rendered.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+	// Index maps URL path prefixes to whether index.html is served instead of the listing of the
+	// directories under them, the longest matching prefix wins.
+	Index map[string]bool `yaml:"index"`
+}
+
+type events struct {
+	// Enabled updates the listings live as files are created, modified and deleted.
+	Enabled bool `yaml:"enabled"`
+	// PollInterval is how often directories are listed for changes where inotify isn't available.
+	PollInterval time.Duration `yaml:"poll_interval"`
+}
+
+// Webhook is an endpoint notified of file events.
+type Webhook struct {
+	// URL receives the events with POST requests.
+	URL string `yaml:"url"`
+	// Secret signs the payloads with HMAC-SHA256, in the X-Filekeep-Signature header.
+	Secret string `yaml:"secret"`
+	// Paths are the glob patterns of the notified paths, "/dir/**" matching everything under /dir. Empty matches all.
+	Paths []string `yaml:"paths"`
+	// Events are the notified events among upload, delete and move. Empty notifies all of them.
+	Events []string `yaml:"events"`
+	// Sites are the host names of the notified sites, "" for the main one. Empty notifies all of them.
+	Sites []string `yaml:"sites"`
+}
+
+// Mount is a directory presented as a top-level directory of the root, under its own name.
+type Mount struct {
+	// Name is the name of the directory at the root, like "disk1". It shadows the entry of the root named the same.
+	Name string `yaml:"name"`
+	// Path is the directory on disk.
+	Path string `yaml:"path"`
+	// HideRules decide which files and directories of the mount are hidden, instead of the ones of the root.
+	HideRules `yaml:",inline"`
+	// ReadOnly refuses the uploads, deletions, moves and jobs writing into the mount.
+	ReadOnly bool `yaml:"read_only"`
+}
+
+// Site is a site served for the requests of its host name instead of the root, with its own files and settings.
+type Site struct {
+	// Root is the root directory of the site.
+	Root string `yaml:"root"`
+	// HideRules decide which files and directories of the site are hidden, instead of the ones of the config.
+	// A site setting none of them uses the ones of the config, see SiteRules.
+	HideRules `yaml:",inline"`
+	// Mounts are the other directories presented as top-level directories of the root of the site.
+	Mounts []Mount `yaml:"mounts"`
+	// Theme is the theme of the site, defaulting to the one of the config.
+	Theme string `yaml:"theme"`
+	// Tokens maps the API token names of the site to their secret values, instead of the tokens of the config.
+	// Without them, uploads, deletions, moves and jobs are disabled on the site.
+	Tokens map[string]string `yaml:"tokens"`
+}
+
+// SiteRules returns the hide rules of the site, the ones of the config unless the site sets any of its own.
+func (c *Config) SiteRules(site Site) HideRules {
+	if site.Hidden == nil && site.HiddenExts == nil && !site.Dotfiles {
+		return c.HideRules
+	}
+	return site.HideRules
+}
+
+type webhooks struct {
+	// Hooks are the notified endpoints.
+	Hooks []Webhook `yaml:"hooks"`
+	// Queue is the file keeping the pending deliveries across restarts. Empty keeps them in memory only.
+	Queue string `yaml:"queue"`
+	// Log is the file the delivery attempts are logged to as JSON lines. Empty disables the log.
+	Log string `yaml:"log"`
+	// Timeout is the timeout of a delivery attempt.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is the number of attempts before giving up on a delivery.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Backoff is the delay before the first retry, doubled by every further failure up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
 // Config stores the config that the manager will use.
 type Config struct {
 	// Web defines the listening address and port.
 	Web web `yaml:"web"`
 	// Root is the root directory. Defaults to ".", the runtime dir.
 	Root string `yaml:"root"`
+	// HideRules decide which files and directories are hidden.
+	HideRules `yaml:",inline"`
+	// Mounts are the other directories presented as top-level directories of the root.
+	Mounts []Mount `yaml:"mounts"`
+	// Theme is the theme of the listings until toggled by the visitor, either "light" or "dark".
+	Theme string `yaml:"theme"`
+	// Sites maps host names, like "docs.example.com", to the sites served for the requests to them.
+	// The requests to other hosts are served the root.
+	Sites map[string]Site `yaml:"sites"`
+	// Debug will show additional debugging info. Verbose output, only switch if needed.
+	Debug bool `yaml:"debug"`
+	// Tokens maps API token names to their secret values. Requests carrying a valid token as
+	// "Authorization: Bearer <token>" may upload files and skip password checks.
+	Tokens map[string]string `yaml:"tokens"`
+	// UploadMaxSize caps the size of each upload, e.g. 10GB. 0 disables the cap.
+	UploadMaxSize datasize.ByteSize `yaml:"upload_max_size"`
+	// Metrics exposes Prometheus metrics at /metrics.
+	Metrics bool `yaml:"metrics"`
+	// Admin defines an optional separate listening address and port for the administrative endpoints,
+	// like /metrics. If the port is 0, they're served by the main listener.
+	Admin admin `yaml:"admin"`
+	// AccessLog configures the log of all requests.
+	AccessLog accessLog `yaml:"access_log"`
+	// TrustedProxies is a slice of networks or addresses of reverse proxies, whose X-Forwarded-For
+	// header is trusted to find out the client address, and X-Forwarded-Prefix header for the links.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// AuditLog is the file security relevant events are appended to, like password attempts,
+	// uploads and deletions. Empty disables the audit log.
+	AuditLog string `yaml:"audit_log"`
+	// BruteForce configures the lockouts after too many wrong passwords.
+	BruteForce bruteForce `yaml:"brute_force"`
+	// RateLimit limits the requests of each client address. Requests with an API token aren't limited.
+	RateLimit rateLimit `yaml:"rate_limit"`
+	// Bandwidth caps the download bandwidth. Requests with an API token aren't throttled.
+	Bandwidth bandwidth `yaml:"bandwidth"`
+	// CacheControl maps URL path prefixes to the Cache-Control header of the files and listings under them,
+	// e.g. "/releases": "public, max-age=3600". The longest matching prefix wins.
+	CacheControl map[string]string `yaml:"cache_control"`
+	// Compression configures the compression of responses.
+	Compression compression `yaml:"compression"`
+	// DirSizes configures the recursive sizes of directories.
+	DirSizes dirSizes `yaml:"dir_sizes"`
+	// Checksums configures the checksums of files.
+	Checksums checksums `yaml:"checksums"`
+	// Archives configures browsing inside archives.
+	Archives archives `yaml:"archives"`
+	// Jobs configures the background extraction and compression of archives.
+	Jobs jobs `yaml:"jobs"`
+	// Readme configures the header and footer files rendered with listings, and index files.
+	Readme readme `yaml:"readme"`
+	// Feeds configures the feeds of directories.
+	Feeds feeds `yaml:"feeds"`
+	// Events configures the live updates of listings.
+	Events events `yaml:"events"`
+	// Webhooks configures the webhooks notified of uploads, deletions and moves.
+	Webhooks webhooks `yaml:"webhooks"`
+}
+
+// HideRules decide which files and directories are hidden from listings and requests.
+type HideRules struct {
 	// Hidden is a slice of hidden files or directories.
 	Hidden []string `yaml:"hidden"`
 	// HiddenExts is a slice of hidden files by extension.
 	HiddenExts []string `yaml:"hidden_extensions"`
 	// Dotfiles will show files and directories starting with a dot.
 	Dotfiles bool `yaml:"dotfiles"`
-	// Debug will show additional debugging info. Verbose output, only switch if needed.
-	Debug bool `yaml:"debug"`
 }
 
 // IsHidden returns whether a path is hidden or not. First checks if path is hidden by path,
 // then by extension, then by being dotfile/dotdir.
-func (c *Config) IsHidden(path ...string) bool {
+func (c *HideRules) IsHidden(path ...string) bool {
 	for _, p := range path {
 		if c.IsHiddenPath(p) || c.IsHiddenExt(p) || c.IsHiddenDot(p) {
 			return true
@@ -47,7 +314,7 @@ func (c *Config) IsHidden(path ...string) bool {
 }
 
 // IsHiddenPath returns whether a path is hidden by checking the Hidden slice in the config.
-func (c *Config) IsHiddenPath(path string) bool {
+func (c *HideRules) IsHiddenPath(path string) bool {
 	path = strings.ToLower(path)
 	for _, v := range c.Hidden {
 		v = strings.TrimRight(v, "/")
@@ -62,7 +329,7 @@ func (c *Config) IsHiddenPath(path string) bool {
 }
 
 // IsHiddenExt returns whether a path is hidden by checking the HiddenExts slice in the config.
-func (c *Config) IsHiddenExt(path string) bool {
+func (c *HideRules) IsHiddenExt(path string) bool {
 	for _, v := range c.HiddenExts {
 		if v == filepath.Ext(path) {
 			return true
@@ -72,7 +339,7 @@ func (c *Config) IsHiddenExt(path string) bool {
 }
 
 // IsHiddenDot returns whether a path is hidden by checking the Dotfiles bool in the config.
-func (c *Config) IsHiddenDot(path string) bool {
+func (c *HideRules) IsHiddenDot(path string) bool {
 	if c.Dotfiles || path == "" || path == "." {
 		return false
 	}
@@ -85,15 +352,125 @@ func (c *Config) IsHiddenDot(path string) bool {
 	return false
 }
 
-var c = &Config{
-	Web: web{
-		Address: "localhost",
-		Port:    8080,
-	},
-	Root:       ".",
-	Hidden:     []string{"/etc/passwd"},
-	HiddenExts: []string{".bak", ".DS_Store"},
-	Dotfiles:   false,
+// Defaults returns the default config, used for the options missing from the config file.
+func Defaults() *Config {
+	return &Config{
+		Web: web{
+			Address: "localhost",
+			Port:    8080,
+		},
+		Root: ".",
+		HideRules: HideRules{
+			Hidden:     []string{"/etc/passwd"},
+			HiddenExts: []string{".bak", ".DS_Store"},
+			Dotfiles:   false,
+		},
+		Mounts: []Mount{},
+		Theme:  "light",
+		Sites:  map[string]Site{},
+		Admin: admin{
+			Address: "localhost",
+		},
+		UploadMaxSize: 10 * datasize.GB,
+		AccessLog: accessLog{
+			Format:     "combined",
+			MaxSize:    100 * datasize.MB,
+			MaxAge:     7 * 24 * time.Hour,
+			MaxBackups: 4,
+		},
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+		CacheControl:   map[string]string{"/": "no-cache"},
+		Compression: compression{
+			Enabled: true,
+			MinSize: datasize.KB,
+			Types: []string{
+				"text/*",
+				"application/json",
+				"application/javascript",
+				"application/xml",
+				"image/svg+xml",
+			},
+			Precompressed: true,
+		},
+		DirSizes: dirSizes{
+			Enabled: false,
+			MaxAge:  5 * time.Minute,
+		},
+		Checksums: checksums{
+			CacheSize:     10000,
+			DigestMaxSize: 0,
+		},
+		Archives: archives{
+			Enabled:       true,
+			MaxSize:       4 * datasize.GB,
+			MaxMembers:    100000,
+			MaxMemberSize: 1 * datasize.GB,
+		},
+		Jobs: jobs{
+			Enabled:  false,
+			Workers:  2,
+			Keep:     time.Hour,
+			MaxSize:  10 * datasize.GB,
+			MaxFiles: 100000,
+		},
+		Readme: readme{
+			Enabled: false,
+			Header:  []string{"HEADER.md", "HEADER.txt"},
+			Footer:  []string{"README.md", "README.txt", "README"},
+			MaxSize: 256 * datasize.KB,
+			Index:   map[string]bool{"/": false},
+		},
+		Feeds: feeds{
+			Enabled: false,
+			Depth:   2,
+			Limit:   50,
+		},
+		Events: events{
+			Enabled:      false,
+			PollInterval: 2 * time.Second,
+		},
+		Webhooks: webhooks{
+			Hooks:       []Webhook{},
+			Timeout:     10 * time.Second,
+			MaxAttempts: 10,
+			Backoff:     10 * time.Second,
+			MaxBackoff:  time.Hour,
+		},
+		BruteForce: bruteForce{
+			IP: LockoutPolicy{
+				Attempts:   0,
+				Lockout:    time.Minute,
+				MaxLockout: time.Hour,
+				ResetAfter: 24 * time.Hour,
+			},
+			Path: LockoutPolicy{
+				Attempts:   0,
+				Lockout:    time.Minute,
+				MaxLockout: 15 * time.Minute,
+				ResetAfter: time.Hour,
+			},
+		},
+	}
+}
+
+var c = Defaults()
+
+// TokenName returns the name of the API token matching token, if any.
+func (c *Config) TokenName(token string) (string, bool) {
+	return MatchToken(c.Tokens, token)
+}
+
+// MatchToken returns the name of the token in tokens matching token, comparing in constant time.
+func MatchToken(tokens map[string]string, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	for name, v := range tokens {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
 }
 
 // Get returns the current config.
@@ -101,20 +478,56 @@ func Get() *Config {
 	return c
 }
 
-// Dump will dump the default config to disk.
-func Dump() error {
-	conf, err := yaml.Marshal(c)
+// Redacted returns a copy of the config with the API tokens, of the sites too, and webhook secrets hidden, to be shown.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.Tokens = make(map[string]string, len(c.Tokens))
+	for name := range c.Tokens {
+		r.Tokens[name] = redacted
+	}
+	r.Sites = make(map[string]Site, len(c.Sites))
+	for host, site := range c.Sites {
+		tokens := make(map[string]string, len(site.Tokens))
+		for name := range site.Tokens {
+			tokens[name] = redacted
+		}
+		site.Tokens = tokens
+		r.Sites[host] = site
+	}
+	r.Webhooks.Hooks = append([]Webhook(nil), c.Webhooks.Hooks...)
+	for i := range r.Webhooks.Hooks {
+		if r.Webhooks.Hooks[i].Secret != "" {
+			r.Webhooks.Hooks[i].Secret = redacted
+		}
+	}
+	return &r
+}
+
+const redacted = "<redacted>"
+
+// YAML returns the config as YAML.
+func (c *Config) YAML() ([]byte, error) {
+	b, err := yaml.Marshal(c)
 	if err != nil {
-		return fmt.Errorf("couldn't marshal config to YAML: %s", err)
+		return nil, fmt.Errorf("couldn't marshal config to YAML: %s", err)
 	}
+	return b, nil
+}
 
-	f, err := os.Create("config.example.yaml")
+// Dump will dump the config to disk, at path.
+func (c *Config) Dump(path string) error {
+	conf, err := c.YAML()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("couldn't open YAML config file for writing: %s", err)
 	}
 
 	if _, err := f.Write(conf); err != nil {
-		return fmt.Errorf("couldn't dump default config to file: %s", err)
+		return fmt.Errorf("couldn't dump config to file: %s", err)
 	}
 
 	if err := f.Close(); err != nil {
@@ -124,24 +537,20 @@ func Dump() error {
 	return nil
 }
 
-// Load will read the config from disk.
-func Load(configPath string) (*Config, error) {
-	f, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't read config file from disk: %s", err)
-	}
-
-	readConf := new(Config)
-	if err := yaml.Unmarshal(f, readConf); err != nil {
-		return nil, fmt.Errorf("couldn't unmarshal config from JSON: %s", err)
-	}
-
-	if readConf.Root == "" {
-		readConf.Root = "."
+// Load will read the config from disk, none if configPath is empty, set the overrides over it, and
+// validate it. Its mistakes are returned as Problems.
+func Load(configPath string, overrides ...Override) (*Config, error) {
+	var f []byte
+	if configPath != "" {
+		var err error
+		if f, err = ioutil.ReadFile(configPath); err != nil {
+			return nil, fmt.Errorf("couldn't read config file from disk: %s", err)
+		}
 	}
 
-	if readConf.Web.Port == 0 {
-		readConf.Web.Port = 8080
+	readConf, err := Parse(f, overrides...)
+	if err != nil {
+		return nil, err
 	}
 
 	c = readConf
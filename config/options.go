@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// EnvPrefix starts the names of the environment variables setting options.
+const EnvPrefix = "FILEKEEP_"
+
+// Option is a setting of the config, which can be set by an environment variable or a flag.
+type Option struct {
+	// Name is the path of the option in the config file, like "web.port".
+	Name string
+	// Env is the environment variable setting the option, like "FILEKEEP_WEB_PORT".
+	Env string
+	// Bool reports whether the option is a boolean, set by a flag without a value.
+	Bool bool
+}
+
+// Override is a value of an option set outside of the config file, by an environment variable or a flag.
+type Override struct {
+	// Option is the name of the option, empty if it's unknown.
+	Option string
+	Value  string
+	// Source is where the value comes from, like "FILEKEEP_WEB_PORT" or "-web.port".
+	Source string
+}
+
+// Options returns every option of the config, in the order of the config file.
+func Options() []Option {
+	var options []Option
+	walk(reflect.ValueOf(Defaults()).Elem(), "", func(name string, v reflect.Value) {
+		options = append(options, Option{
+			Name: name,
+			Env:  EnvPrefix + strings.ToUpper(strings.Replace(name, ".", "_", -1)),
+			Bool: v.Kind() == reflect.Bool,
+		})
+	})
+	return options
+}
+
+// walk calls fn with the name and the value of every option in the config struct v, named under prefix.
+// Structs are walked into, except for the ones inlined, the other values are options.
+func walk(v reflect.Value, prefix string, fn func(name string, v reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		field := v.Field(i)
+		if len(tag) > 1 && tag[1] == "inline" {
+			walk(field, prefix, fn)
+			continue
+		}
+		name := prefix + tag[0]
+		if field.Kind() == reflect.Struct {
+			walk(field, name+".", fn)
+			continue
+		}
+		fn(name, field)
+	}
+}
+
+// Env returns the options set by the environment variables in environ, formatted like os.Environ,
+// sorted by variable. The variables starting with EnvPrefix but naming no option are returned
+// without an option, to be reported.
+func Env(environ []string) []Override {
+	envs := make(map[string]string)
+	for _, o := range Options() {
+		envs[o.Env] = o.Name
+	}
+
+	var overrides []Override
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv, EnvPrefix) {
+			continue
+		}
+		overrides = append(overrides, Override{Option: envs[kv[:i]], Value: kv[i+1:], Source: kv[:i]})
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Source < overrides[j].Source })
+	return overrides
+}
+
+// Set sets the option name from value. Strings are taken as they are, lists of strings and maps may be
+// given as "a,b" and "key=value,key=value", and everything else is read as YAML, like "10s" or
+// "[{url: https://example.com}]".
+func (c *Config) Set(name, value string) error {
+	var field reflect.Value
+	walk(reflect.ValueOf(c).Elem(), "", func(n string, v reflect.Value) {
+		if n == name {
+			field = v
+		}
+	})
+	if !field.IsValid() {
+		return fmt.Errorf("unknown option")
+	}
+
+	v, err := decode(value, field.Type())
+	if err != nil {
+		return err
+	}
+	field.Set(v)
+	return nil
+}
+
+// decode returns the value of type t read from value, as described by Set.
+func decode(value string, t reflect.Type) (reflect.Value, error) {
+	trimmed := strings.TrimSpace(value)
+	switch {
+	case t.Kind() == reflect.String:
+		return reflect.ValueOf(value).Convert(t), nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String && !strings.HasPrefix(trimmed, "["):
+		s := reflect.MakeSlice(t, 0, 0)
+		for _, item := range splitList(value) {
+			s = reflect.Append(s, reflect.ValueOf(item).Convert(t.Elem()))
+		}
+		return s, nil
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && !strings.HasPrefix(trimmed, "{"):
+		m := reflect.MakeMap(t)
+		for _, item := range splitList(value) {
+			i := strings.Index(item, "=")
+			if i < 0 {
+				return reflect.Value{}, fmt.Errorf("%q isn't like key=value", item)
+			}
+			v, err := decode(item[i+1:], t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(reflect.ValueOf(item[:i]).Convert(t.Key()), v)
+		}
+		return m, nil
+	}
+
+	v := reflect.New(t)
+	if err := yaml.UnmarshalStrict([]byte(value), v.Interface()); err != nil {
+		msg := err.Error()
+		if terr, ok := err.(*yaml.TypeError); ok {
+			msg = terr.Errors[0]
+		}
+		msg = strings.TrimPrefix(strings.TrimPrefix(msg, "yaml: "), "line 1: ")
+		return reflect.Value{}, fmt.Errorf("%s", msg)
+	}
+	return v.Elem(), nil
+}
+
+// splitList splits a comma separated list, trimming its items. An empty value is an empty list.
+func splitList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+// overridden returns the override of the option field or of one of its parents, like "webhooks.hooks"
+// for "webhooks.hooks[0].url", if any. The last one wins, as it's the one applied.
+func overridden(overrides []Override, field string) (Override, bool) {
+	for i := len(overrides) - 1; i >= 0; i-- {
+		o := overrides[i]
+		if o.Option != "" && (field == o.Option || strings.HasPrefix(field, o.Option+".") || strings.HasPrefix(field, o.Option+"[")) {
+			return o, true
+		}
+	}
+	return Override{}, false
+}
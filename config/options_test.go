@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+func TestSet(t *testing.T) {
+	c := Defaults()
+	values := map[string]string{
+		"web.port":               "9000",
+		"hidden_extensions":      ".exe, .bat",
+		"dotfiles":               "true",
+		"access_log.path":        "-",
+		"access_log.max_size":    "10MB",
+		"brute_force.ip.lockout": "30s",
+		"bandwidth.paths":        "/isos=1MB,/docs=10KB",
+		"readme.index":           "/=true",
+		"webhooks.hooks":         "[{url: https://example.com/hook, events: [upload]}]",
+	}
+	for name, v := range values {
+		if err := c.Set(name, v); err != nil {
+			t.Fatalf("couldn't set %s to %q: %s", name, v, err)
+		}
+	}
+	if c.Web.Port != 9000 || len(c.HiddenExts) != 2 || c.HiddenExts[1] != ".bat" || !c.Dotfiles || c.AccessLog.Path != "-" ||
+		c.AccessLog.MaxSize != 10*datasize.MB || c.BruteForce.IP.Lockout != 30*time.Second ||
+		c.Bandwidth.Paths["/isos"] != datasize.MB || !c.Readme.Index["/"] ||
+		len(c.Webhooks.Hooks) != 1 || c.Webhooks.Hooks[0].Events[0] != "upload" {
+		t.Errorf("unexpected config after setting options: %+v", c)
+	}
+
+	for name, v := range map[string]string{"web.port": "abc", "web": "x", "cache_control": "/"} {
+		if err := c.Set(name, v); err == nil {
+			t.Errorf("expected setting %s to %q to fail", name, v)
+		}
+	}
+}
+
+func TestParseOverrides(t *testing.T) {
+	env := Env([]string{"PATH=/bin", "FILEKEEP_WEB_PORT=9100", "FILEKEEP_ROOT=/nonexistent/filekeep", "FILEKEEP_NOPE=1"})
+	if len(env) != 3 || env[0].Option != "" || env[1].Option != "root" || env[2].Option != "web.port" {
+		t.Fatalf("unexpected overrides from the environment: %+v", env)
+	}
+
+	_, err := Parse([]byte("web:\n  port: 9000\n"), env...)
+	want := Problems{
+		{Message: "unknown option", Source: "FILEKEEP_NOPE"},
+		{Field: "root", Message: "stat /nonexistent/filekeep: no such file or directory", Source: "FILEKEEP_ROOT"},
+	}
+	if problems, ok := err.(Problems); !ok || len(problems) != len(want) || problems[0] != want[0] || problems[1] != want[1] {
+		t.Errorf("expected problems %v, got %v", want, err)
+	}
+
+	flags := []Override{{Option: "web.port", Value: "9200", Source: "-web.port"}}
+	c, err := Parse([]byte("web:\n  port: 9000\n  address: 0.0.0.0\n"), append(env[2:], flags...)...)
+	if err != nil || c.Web.Port != 9200 || c.Web.Address != "0.0.0.0" {
+		t.Errorf("expected the flags over the environment over the file, got %v, %v", c, err)
+	}
+}
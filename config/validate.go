@@ -0,0 +1,413 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// Problem is a mistake in the config.
+type Problem struct {
+	// Line is the line of the config file the problem is at, 0 if unknown.
+	Line int
+	// Field is the path of the option, like "web.port" or "webhooks.hooks[0].url". Empty for syntax errors.
+	Field   string
+	Message string
+	// Source is the environment variable or the flag the wrong value comes from, empty for the config file.
+	Source string
+}
+
+func (p Problem) Error() string {
+	var prefix string
+	if p.Source != "" {
+		prefix = p.Source + ": "
+	} else if p.Line > 0 {
+		prefix = fmt.Sprintf("line %d: ", p.Line)
+	}
+	if p.Field != "" {
+		prefix += p.Field + ": "
+	}
+	return prefix + p.Message
+}
+
+// Problems are all the mistakes found in a config, in the order of the file.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	msgs := make([]string, len(p))
+	for i, problem := range p {
+		msgs[i] = problem.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var (
+	lineRe     = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	notFoundRe = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// Parse reads the YAML config b over the defaults, then sets the overrides in order over it. Unknown keys,
+// values of the wrong type and invalid options are all reported together, as Problems with their line in b,
+// or their source if overridden.
+func Parse(b []byte, overrides ...Override) (*Config, error) {
+	// strictly decoding over the defaults would take the keys of their maps for duplicates
+	var problems Problems
+	if err := yaml.UnmarshalStrict(b, new(Config)); err != nil {
+		msgs := []string{err.Error()}
+		if terr, ok := err.(*yaml.TypeError); ok {
+			msgs = terr.Errors
+		}
+		for _, msg := range msgs {
+			problems = append(problems, yamlProblem(msg))
+		}
+		// the type errors leave the defaults in place of the wrong values, go on with them
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return nil, problems
+		}
+	}
+
+	conf := Defaults()
+	clearMaps(conf, b)
+	if err := yaml.Unmarshal(b, conf); err != nil {
+		// the type errors were reported by the strict decoding already
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return nil, append(problems, yamlProblem(err.Error()))
+		}
+	}
+	for _, o := range overrides {
+		if err := conf.Set(o.Option, o.Value); err != nil {
+			problems = append(problems, Problem{Field: o.Option, Message: err.Error(), Source: o.Source})
+		}
+	}
+	for _, p := range conf.Validate() {
+		if o, ok := overridden(overrides, p.Field); ok {
+			p.Source = o.Source
+		} else {
+			p.Line = locate(b, p.Field)
+		}
+		problems = append(problems, p)
+	}
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool {
+			return problems[j].Line == 0 && problems[i].Line != 0 || problems[i].Line != 0 && problems[i].Line < problems[j].Line
+		})
+		return nil, problems
+	}
+	return conf, nil
+}
+
+// clearMaps empties the maps of conf which are set by the YAML config b, so they replace the default ones
+// instead of being merged into them.
+func clearMaps(conf *Config, b []byte) {
+	var tree map[interface{}]interface{}
+	if err := yaml.Unmarshal(b, &tree); err != nil {
+		return
+	}
+	walk(reflect.ValueOf(conf).Elem(), "", func(name string, v reflect.Value) {
+		if v.Kind() != reflect.Map {
+			return
+		}
+		node := interface{}(tree)
+		for _, key := range strings.Split(name, ".") {
+			m, ok := node.(map[interface{}]interface{})
+			if !ok {
+				return
+			}
+			if node, ok = m[key]; !ok {
+				return
+			}
+		}
+		v.Set(reflect.Zero(v.Type()))
+	})
+}
+
+// yamlProblem returns the problem described by an error message of the YAML decoder.
+func yamlProblem(msg string) Problem {
+	m := lineRe.FindStringSubmatch(msg)
+	if m == nil {
+		return Problem{Message: strings.TrimPrefix(msg, "yaml: ")}
+	}
+	line, _ := strconv.Atoi(m[1])
+	if f := notFoundRe.FindStringSubmatch(m[2]); f != nil {
+		return Problem{Line: line, Field: f[1], Message: "unknown option"}
+	}
+	return Problem{Line: line, Message: strings.TrimPrefix(m[2], "yaml: ")}
+}
+
+// Validate returns the problems of the config which would keep filekeep from serving as configured,
+// without their lines.
+func (c *Config) Validate() Problems {
+	var problems Problems
+	fail := func(field, format string, args ...interface{}) {
+		problems = append(problems, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	checkFiles(fail, "", c.Root, c.HideRules, c.Mounts)
+	checkTheme(fail, "theme", c.Theme)
+	hosts := make([]string, 0, len(c.Sites))
+	for host := range c.Sites {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		site, field := c.Sites[host], "sites."+host
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			fail(field, "%q isn't a host name", host)
+		} else if _, port, err := net.SplitHostPort(host); err == nil && port != "" {
+			fail(field, "%q has a port, the sites are selected by host name only", host)
+		}
+		checkFiles(fail, field+".", site.Root, c.SiteRules(site), site.Mounts)
+		if site.Theme != "" {
+			checkTheme(fail, field+".theme", site.Theme)
+		}
+		checkTokens(fail, field+".", site.Tokens)
+	}
+
+	if c.Web.Port == 0 {
+		fail("web.port", "0 isn't a port, leave it out to listen on 8080")
+	}
+	checkAddress(fail, "web.address", c.Web.Address)
+	if c.Admin.Port != 0 {
+		checkAddress(fail, "admin.address", c.Admin.Address)
+		if c.Admin.Port == c.Web.Port && (c.Admin.Address == c.Web.Address || c.Admin.Address == "" || c.Web.Address == "") {
+			fail("admin.port", "the admin listener can't listen on the same address as web, %s", c.Web)
+		}
+	}
+
+	switch c.AccessLog.Format {
+	case "", "combined", "json":
+	default:
+		fail("access_log.format", "%q isn't combined or json", c.AccessLog.Format)
+	}
+	if c.AccessLog.Path == "-" && (c.AccessLog.MaxSize != 0 || c.AccessLog.MaxAge != 0) {
+		fail("access_log.path", "the access log can't be rotated when written to stdout, remove max_size and max_age")
+	}
+	for i, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			fail(fmt.Sprintf("trusted_proxies[%d]", i), "%q isn't an address or a network", proxy)
+		}
+	}
+
+	checkTokens(fail, "", c.Tokens)
+
+	for field, p := range map[string]LockoutPolicy{"brute_force.ip": c.BruteForce.IP, "brute_force.path": c.BruteForce.Path} {
+		if p.Attempts > 0 && p.MaxLockout < p.Lockout {
+			fail(field+".max_lockout", "shorter than the lockout, %s", p.Lockout)
+		}
+	}
+	if c.RateLimit.Requests == 0 && c.RateLimit.Burst != 0 {
+		fail("rate_limit.burst", "set without requests, which disables the rate limit")
+	}
+	if c.Jobs.Enabled && c.Jobs.Workers < 1 {
+		fail("jobs.workers", "needs at least 1 worker")
+	}
+
+	for i, hook := range c.Webhooks.Hooks {
+		field := fmt.Sprintf("webhooks.hooks[%d]", i)
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(field+".url", "%q isn't a http or https URL", hook.URL)
+		}
+		for j, event := range hook.Events {
+			switch event {
+			case "upload", "delete", "move":
+			default:
+				fail(fmt.Sprintf("%s.events[%d]", field, j), "%q isn't upload, delete or move", event)
+			}
+		}
+		for j, site := range hook.Sites {
+			if _, ok := c.Sites[site]; !ok && site != "" {
+				fail(fmt.Sprintf("%s.sites[%d]", field, j), "%q isn't one of the sites", site)
+			}
+		}
+	}
+	if len(c.Webhooks.Hooks) > 0 && c.Webhooks.MaxBackoff < c.Webhooks.Backoff {
+		fail("webhooks.max_backoff", "shorter than the backoff, %s", c.Webhooks.Backoff)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Field < problems[j].Field })
+	return problems
+}
+
+// checkFiles fails for the mistakes of the root directory, the rules and the mounts of a site at prefix.
+func checkFiles(fail func(field, format string, args ...interface{}), prefix, root string, rules HideRules, mounts []Mount) {
+	if root == "" {
+		fail(prefix+"root", "empty, leave it out to serve the current directory")
+	} else if info, err := os.Stat(root); err != nil {
+		fail(prefix+"root", "%s", err)
+	} else if !info.IsDir() {
+		fail(prefix+"root", "%q isn't a directory", root)
+	}
+	checkHiddenExts(fail, prefix, rules.HiddenExts)
+
+	names := make(map[string]bool)
+	for i, m := range mounts {
+		field := fmt.Sprintf("%smounts[%d]", prefix, i)
+		switch {
+		case m.Name == "" || m.Name == "." || m.Name == "..":
+			fail(field+".name", "%q isn't a directory name", m.Name)
+		case strings.ContainsAny(m.Name, `/\`):
+			fail(field+".name", "%q can't hold a slash, mounts are top-level directories", m.Name)
+		case strings.HasPrefix(m.Name, "_"):
+			fail(field+".name", "%q can't start with an underscore, like the paths of filekeep", m.Name)
+		case names[m.Name]:
+			fail(field+".name", "%q is already mounted", m.Name)
+		}
+		names[m.Name] = true
+		if m.Path == "" {
+			fail(field+".path", "empty")
+		} else if info, err := os.Stat(m.Path); err != nil {
+			fail(field+".path", "%s", err)
+		} else if !info.IsDir() {
+			fail(field+".path", "%q isn't a directory", m.Path)
+		}
+		checkHiddenExts(fail, field+".", m.HiddenExts)
+	}
+}
+
+// checkTheme fails if the theme isn't light or dark.
+func checkTheme(fail func(field, format string, args ...interface{}), field, theme string) {
+	if theme != "light" && theme != "dark" {
+		fail(field, "%q isn't light or dark", theme)
+	}
+}
+
+// checkTokens fails for the empty tokens and the tokens shared by several names, of a site at prefix.
+func checkTokens(fail func(field, format string, args ...interface{}), prefix string, tokens map[string]string) {
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	secrets := make(map[string]string)
+	for _, name := range names {
+		token := tokens[name]
+		if token == "" {
+			fail(prefix+"tokens."+name, "empty token")
+		} else if other, ok := secrets[token]; ok {
+			fail(prefix+"tokens."+name, "same token as %q, the requests couldn't be told apart", other)
+		}
+		secrets[token] = name
+	}
+}
+
+// checkHiddenExts fails for the hidden extensions without their dot, of the rules at prefix.
+func checkHiddenExts(fail func(field, format string, args ...interface{}), prefix string, exts []string) {
+	for i, ext := range exts {
+		if !strings.HasPrefix(ext, ".") {
+			fail(fmt.Sprintf("%shidden_extensions[%d]", prefix, i), "%q doesn't start with a dot, like %q", ext, "."+ext)
+		}
+	}
+}
+
+// checkAddress fails if the listening address can't be resolved.
+func checkAddress(fail func(field, format string, args ...interface{}), field, address string) {
+	if address == "" || net.ParseIP(address) != nil {
+		return
+	}
+	if _, err := net.LookupHost(address); err != nil {
+		fail(field, "couldn't resolve %q: %s", address, err)
+	}
+}
+
+// locate returns the line of the option at field in the YAML src, like "web.port" or "hooks[0].url",
+// or of its closest parent found. It follows the indentation of block style YAML, 0 if nothing is found.
+func locate(src []byte, field string) int {
+	lines := strings.Split(string(src), "\n")
+	start, end, line := 0, len(lines), 0
+
+	for _, seg := range strings.Split(strings.Replace(field, "[", ".[", -1), ".") {
+		indent := blockIndent(lines, start, end)
+		if indent < 0 {
+			break
+		}
+		found := -1
+		if strings.HasPrefix(seg, "[") {
+			n, _ := strconv.Atoi(strings.Trim(seg, "[]"))
+			for i := start; i < end && found < 0; i++ {
+				if indentOf(lines[i]) == indent && strings.HasPrefix(strings.TrimSpace(lines[i]), "- ") {
+					if n == 0 {
+						found = i
+					}
+					n--
+				}
+			}
+			if found < 0 {
+				break
+			}
+			// read the item as a block, its first key indented like the next ones
+			lines[found] = strings.Replace(lines[found], "-", " ", 1)
+		} else {
+			for i := start; i < end && found < 0; i++ {
+				trimmed := strings.TrimSpace(lines[i])
+				if indentOf(lines[i]) == indent && (strings.HasPrefix(trimmed, seg+":") || strings.HasPrefix(trimmed, `"`+seg+`":`)) {
+					found = i
+				}
+			}
+			if found < 0 {
+				break
+			}
+		}
+
+		line = found + 1
+		if strings.HasPrefix(seg, "[") {
+			// the item's first line holds its first key
+			start, end = found, itemEnd(lines, found, indent, end)
+		} else {
+			start, end = found+1, blockEnd(lines, found, end)
+		}
+	}
+	return line
+}
+
+// blockIndent returns the indentation of the first line holding something in lines[start:end], -1 if none.
+func blockIndent(lines []string, start, end int) int {
+	for i := start; i < end; i++ {
+		if trimmed := strings.TrimSpace(lines[i]); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return indentOf(lines[i])
+		}
+	}
+	return -1
+}
+
+// blockEnd returns the end of the block of the key at lines[at]: the next line indented less, or
+// as much but not a sequence item, as sequences may be indented like their key.
+func blockEnd(lines []string, at, end int) int {
+	indent := indentOf(lines[at])
+	for i := at + 1; i < end; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := indentOf(lines[i]); n < indent || n == indent && !strings.HasPrefix(trimmed, "- ") {
+			return i
+		}
+	}
+	return end
+}
+
+// itemEnd returns the end of the sequence item at lines[at], its dash indented by indent: the next line
+// indented as much or less.
+func itemEnd(lines []string, at, indent, end int) int {
+	for i := at + 1; i < end; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indentOf(lines[i]) <= indent {
+			return i
+		}
+	}
+	return end
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
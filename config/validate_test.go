@@ -0,0 +1,66 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := `web:
+  port: 9000
+  adress: 0.0.0.0
+root: /nonexistent/filekeep
+hidden_extensions:
+- .exe
+- bat
+tokens:
+  ci: same
+  deploy: same
+webhooks:
+  hooks:
+  - url: https://example.com/hook
+    events: [upload]
+  - url: ftp://example.com
+    secret: s3cret
+    sites:
+    - nope.example
+rate_limit:
+  requests: abc
+`
+	_, err := Parse([]byte(src))
+	problems, ok := err.(Problems)
+	if !ok {
+		t.Fatalf("expected problems, got %v", err)
+	}
+
+	want := []string{
+		`line 3: adress: unknown option`,
+		`line 4: root: stat /nonexistent/filekeep: no such file or directory`,
+		`line 7: hidden_extensions[1]: "bat" doesn't start with a dot, like ".bat"`,
+		`line 10: tokens.deploy: same token as "ci", the requests couldn't be told apart`,
+		`line 15: webhooks.hooks[1].url: "ftp://example.com" isn't a http or https URL`,
+		`line 18: webhooks.hooks[1].sites[0]: "nope.example" isn't one of the sites`,
+		"line 20: cannot unmarshal !!str `abc` into float64",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %d: %s", len(want), len(problems), err)
+	}
+	for i, p := range problems {
+		if p.Error() != want[i] {
+			t.Errorf("expected problem %d to be %q, got %q", i, want[i], p.Error())
+		}
+	}
+
+	if _, err := Parse([]byte("web:\n  port: [")); err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Errorf("expected a syntax error with its line, got %v", err)
+	}
+	if c, err := Parse([]byte("web:\n  port: 9000\ncache_control:\n  /: public\n")); err != nil || c.Web.Port != 9000 || c.Root != "." || c.CacheControl["/"] != "public" {
+		t.Errorf("expected a valid config over the defaults, got %v", err)
+	}
+	if c, err := Parse([]byte("cache_control:\n  /docs: public\n")); err != nil || len(c.CacheControl) != 1 || c.CacheControl["/docs"] != "public" {
+		t.Errorf("expected the cache_control of the file to replace the default one, got %v, %v", c, err)
+	}
+	if c, err := Parse([]byte("web:\n  port: 9000\n")); err != nil || c.CacheControl["/"] != "no-cache" || len(c.Readme.Index) != 1 {
+		t.Errorf("expected the default maps when the file doesn't set them, got %v, %v", c, err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"filekeep/config"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configCommand dumps, validates or shows the config, or lists its options, and returns the exit code.
+func configCommand(args []string) int {
+	flags := newFlagSet("config", "dump|validate|show|options")
+	out := flags.String("out", exampleConfig, "dump the config to `path`, - for stdout")
+	args = parseFlags(flags, args, 1)
+	if len(args) != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "dump":
+		if err := loadConfig(); err != nil {
+			logConfigError(err)
+			return exitFailure
+		}
+		if *out == "-" {
+			b, err := c.YAML()
+			if err != nil {
+				logrus.WithError(err).Error("couldn't dump config")
+				return exitFailure
+			}
+			os.Stdout.Write(b)
+			return exitOK
+		}
+		if err := c.Dump(*out); err != nil {
+			logrus.WithError(err).Error("couldn't dump config")
+			return exitFailure
+		}
+		logrus.Infof("dumped the config to %s", *out)
+		return exitOK
+	case "validate":
+		if *configFlag == "" && len(overrides()) == 0 {
+			logrus.Error("no config file to validate, use -config")
+			return exitUsage
+		}
+		if err := loadConfig(); err != nil {
+			logConfigError(err)
+			return exitFailure
+		}
+		logrus.WithField("config", *configFlag).Info("config is valid")
+		return exitOK
+	case "show":
+		if err := loadConfig(); err != nil {
+			logConfigError(err)
+			return exitFailure
+		}
+		b, err := c.Redacted().YAML()
+		if err != nil {
+			logrus.WithError(err).Error("couldn't show config")
+			return exitFailure
+		}
+		os.Stdout.Write(b)
+		return exitOK
+	case "options":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OPTION\tFLAG\tENVIRONMENT")
+		for _, o := range config.Options() {
+			fmt.Fprintf(w, "%s\t-%s\t%s\n", o.Name, o.Name, o.Env)
+		}
+		w.Flush()
+		return exitOK
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"filekeep/web"
+
+	"github.com/sirupsen/logrus"
+)
+
+// exportCommand writes a static mirror of the root directory, or of a site, as described by the flags in args,
+// and returns the exit code.
+func exportCommand(args []string) int {
+	flags := newFlagSet("export", "-out dir [flags]")
+	out := flags.String("out", "", "directory to write the static mirror to")
+	prefix := flags.String("prefix", "", "URL path the mirror is published at, defaults to web.base_path")
+	link := flags.Bool("link", false, "hard link the files instead of copying them")
+	site := flags.String("site", "", "host name of the site to export, instead of the root")
+	flags.Parse(args)
+	if *out == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		logConfigError(err)
+		return exitFailure
+	}
+
+	opts := web.OptionsFromConfig(c)
+	if *site != "" {
+		var ok bool
+		if opts, ok = opts.ForHost(*site); !ok {
+			logrus.Errorf("no site for %q in the config", *site)
+			return exitUsage
+		}
+	}
+	if isSet(flags, "prefix") {
+		opts.Prefix = *prefix
+	}
+	stats, err := web.Export(opts, web.ExportOptions{Out: *out, Link: *link})
+	if err != nil {
+		logrus.WithError(err).Error("couldn't export")
+		return exitFailure
+	}
+	logrus.WithFields(logrus.Fields{
+		"dirs":      stats.Dirs,
+		"unchanged": stats.Unchanged,
+		"files":     stats.Files,
+		"removed":   stats.Removed,
+	}).Info("exported")
+	return exitOK
+}
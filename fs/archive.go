@@ -0,0 +1,545 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"filekeep/metrics"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrArchiveTooBig is returned for archives over the MaxSize or MaxMembers of Archives.
+	ErrArchiveTooBig = errors.New("archive too big to browse")
+	// ErrMemberTooBig is returned when opening archive members over the MaxMemberSize of Archives.
+	ErrMemberTooBig = errors.New("archive member too big to extract")
+)
+
+// archiveIndexes is the number of archive indexes cached.
+const archiveIndexes = 32
+
+// ArchiveKind returns the kind of archive of the file name: "zip", "tar" or "tgz", or "" if it's not one.
+func ArchiveKind(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tgz"
+	}
+	return ""
+}
+
+// Archives makes the ZIP and tar archives browsable as directories, within limits. Safe for concurrent use.
+type Archives struct {
+	// MaxSize is the size in bytes over which archives aren't browsable. 0 disables the limit.
+	MaxSize int64
+	// MaxMembers is the number of members over which archives aren't browsable. 0 disables the limit.
+	MaxMembers int
+	// MaxMemberSize is the size in bytes over which members can't be extracted. 0 disables the limit.
+	MaxMemberSize int64
+
+	mu      sync.Mutex
+	indexes map[string]*archiveIndex
+}
+
+// NewArchives returns Archives with the limits.
+func NewArchives(maxSize int64, maxMembers int, maxMemberSize int64) *Archives {
+	return &Archives{
+		MaxSize:       maxSize,
+		MaxMembers:    maxMembers,
+		MaxMemberSize: maxMemberSize,
+		indexes:       make(map[string]*archiveIndex),
+	}
+}
+
+// archiveMember is a file or directory in an archive.
+type archiveMember struct {
+	// name is the cleaned path in the archive, "" for its root.
+	name string
+	// raw is the name as stored in the archive, empty for implied directories.
+	raw      string
+	isDir    bool
+	size     int64
+	modTime  time.Time
+	mode     os.FileMode
+	children []string
+}
+
+// archiveIndex lists the members of an archive, valid while its size and modification time don't change.
+type archiveIndex struct {
+	path    string
+	kind    string
+	size    int64
+	modTime time.Time
+	members map[string]*archiveMember
+}
+
+// memberRef ties a node to the archive member it represents.
+type memberRef struct {
+	index  *archiveIndex
+	member *archiveMember
+}
+
+// InArchive returns whether the node is a member of an archive.
+func (n *Node) InArchive() bool {
+	return n.member != nil
+}
+
+// cleanMember returns the cleaned path of an archive member name, or false if it's unsafe, like
+// absolute names or names going up with "..", which would escape the archive when extracted.
+func cleanMember(name string) (string, bool) {
+	if name == "" || strings.Contains(name, `\`) || strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	for _, part := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	cleaned := pathpkg.Clean(name)
+	if cleaned == "." {
+		return "", false
+	}
+	return cleaned, true
+}
+
+// add adds a member to the index, implying its parent directories.
+func (idx *archiveIndex) add(m *archiveMember) {
+	if existing, ok := idx.members[m.name]; ok {
+		if existing.isDir && existing.raw == "" && m.isDir {
+			// a directory implied by its children takes the metadata of its own entry
+			existing.raw, existing.modTime, existing.mode = m.raw, m.modTime, m.mode
+		}
+		// otherwise the first entry of a name wins, the one opened by OpenMember
+		return
+	}
+	idx.members[m.name] = m
+
+	parent := pathpkg.Dir(m.name)
+	if parent == "." {
+		parent = ""
+	}
+	p, ok := idx.members[parent]
+	if !ok {
+		p = &archiveMember{name: parent, isDir: true, modTime: m.modTime, mode: os.ModeDir | 0755}
+		idx.add(p)
+	}
+	p.children = append(p.children, m.name)
+}
+
+// index returns the index of the archive at path, described by info, reading it if it isn't cached.
+func (a *Archives) index(path string, info os.FileInfo) (*archiveIndex, error) {
+	a.mu.Lock()
+	idx, ok := a.indexes[path]
+	a.mu.Unlock()
+	if ok && idx.size == info.Size() && idx.modTime.Equal(info.ModTime()) {
+		metrics.CacheHit("archives")
+		return idx, nil
+	}
+	metrics.CacheMiss("archives")
+
+	if a.MaxSize > 0 && info.Size() > a.MaxSize {
+		return nil, ErrArchiveTooBig
+	}
+
+	idx, err := readIndex(path, info, a.MaxMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k := range a.indexes {
+		if len(a.indexes) < archiveIndexes {
+			break
+		}
+		delete(a.indexes, k)
+	}
+	a.indexes[path] = idx
+	return idx, nil
+}
+
+// readIndex reads the index of the archive at path, described by info. Archives with more than maxMembers
+// members return ErrArchiveTooBig, unless maxMembers is 0.
+func readIndex(path string, info os.FileInfo, maxMembers int) (*archiveIndex, error) {
+	idx := &archiveIndex{
+		path:    path,
+		kind:    ArchiveKind(path),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		members: make(map[string]*archiveMember),
+	}
+	idx.members[""] = &archiveMember{isDir: true, modTime: info.ModTime(), mode: os.ModeDir | 0755}
+
+	var err error
+	if idx.kind == "zip" {
+		err = readZip(idx, maxMembers)
+	} else {
+		err = readTar(idx, maxMembers)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range idx.members {
+		sort.Strings(m.children)
+	}
+	return idx, nil
+}
+
+func readZip(idx *archiveIndex, maxMembers int) error {
+	zr, err := zip.OpenReader(idx.path)
+	if err != nil {
+		return fmt.Errorf("couldn't open zip archive: %s", err)
+	}
+	defer zr.Close()
+
+	if maxMembers > 0 && len(zr.File) > maxMembers {
+		return ErrArchiveTooBig
+	}
+	for _, f := range zr.File {
+		name, ok := cleanMember(f.Name)
+		if !ok {
+			continue
+		}
+		info := f.FileInfo()
+		idx.add(&archiveMember{
+			name:    name,
+			raw:     f.Name,
+			isDir:   info.IsDir(),
+			size:    int64(f.UncompressedSize64),
+			modTime: f.Modified,
+			mode:    info.Mode(),
+		})
+	}
+	return nil
+}
+
+// openTar returns a tar reader of the archive, decompressing it if needed, and a function closing it.
+func openTar(idx *archiveIndex) (*tar.Reader, func() error, error) {
+	f, err := os.Open(idx.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't open tar archive: %s", err)
+	}
+	if idx.kind != "tgz" {
+		return tar.NewReader(f), f.Close, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("couldn't decompress tar archive: %s", err)
+	}
+	return tar.NewReader(gz), func() error {
+		gz.Close()
+		return f.Close()
+	}, nil
+}
+
+func readTar(idx *archiveIndex, maxMembers int) error {
+	tr, closer, err := openTar(idx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	for count := 1; ; count++ {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read tar archive: %s", err)
+		}
+		if maxMembers > 0 && count > maxMembers {
+			return ErrArchiveTooBig
+		}
+
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeDir {
+			// links and devices aren't served
+			continue
+		}
+		name, ok := cleanMember(h.Name)
+		if !ok {
+			continue
+		}
+		idx.add(&archiveMember{
+			name:    name,
+			raw:     h.Name,
+			isDir:   h.Typeflag == tar.TypeDir,
+			size:    h.Size,
+			modTime: h.ModTime,
+			mode:    h.FileInfo().Mode(),
+		})
+	}
+}
+
+// readArchive returns the node of the archive member at path, a path on disk going through an archive,
+// like "root/bundle.zip/docs/readme.txt".
+func (f *FS) readArchive(path string) (*Node, error) {
+	archive := path
+	for !f.IsRoot(archive) {
+		parent := filepath.Dir(archive)
+		if parent == archive {
+			break
+		}
+		archive = parent
+
+		info, err := os.Stat(archive)
+		if err != nil {
+			continue
+		}
+		if !info.Mode().IsRegular() || ArchiveKind(archive) == "" {
+			break
+		}
+		if f.IsHidden(archive) {
+			f.Log.Debugf("archive %q is hidden, returning ErrFileNotFound", archive)
+			return nil, ErrFileNotFound
+		}
+
+		inner := filepath.ToSlash(strings.TrimPrefix(path, archive+string(filepath.Separator)))
+		return f.readMember(archive, info, inner)
+	}
+	f.Log.Debugf("path %q isn't on disk nor in an archive, returning ErrFileNotFound", path)
+	return nil, ErrFileNotFound
+}
+
+// ReadArchive returns the node of the root directory of the archive at path.
+func (f *FS) ReadArchive(path string) (*Node, error) {
+	if f.Archives == nil || f.IsHidden(path) || ArchiveKind(path) == "" {
+		return nil, ErrFileNotFound
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, ErrFileNotFound
+	}
+	return f.readMember(path, info, "")
+}
+
+func (f *FS) readMember(archive string, info os.FileInfo, inner string) (*Node, error) {
+	idx, err := f.Archives.index(archive, info)
+	if err != nil {
+		f.Log.Debugf("couldn't index archive %q: %s", archive, err)
+		return nil, ErrFileNotFound
+	}
+	m, ok := idx.members[inner]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+
+	// members are protected by the password of the archive
+	password := f.newNode(archive, info).Password
+	n := f.memberNode(idx, m, password)
+	if inner == "" {
+		n.Name = filepath.Base(archive)
+	}
+	f.lsMember(idx, m, n, 0)
+	return n, nil
+}
+
+// lsMember adds the children of the archive directory m to its node n, recursively up to dirLimit like lsDir.
+func (f *FS) lsMember(idx *archiveIndex, m *archiveMember, n *Node, count int) {
+	count++
+	for _, name := range m.children {
+		child := idx.members[name]
+		if f.IsHidden(filepath.Join(idx.path, filepath.FromSlash(name)), pathpkg.Base(name)) {
+			continue
+		}
+
+		cn := f.memberNode(idx, child, n.Password)
+		if child.isDir {
+			if count > dirLimit {
+				continue
+			}
+			f.lsMember(idx, child, cn, count)
+			n.Dirs = append(n.Dirs, cn)
+		} else {
+			n.FilesSize += cn.Size
+			n.Files = append(n.Files, cn)
+		}
+	}
+}
+
+// memberNode returns the node of the member m of the archive idx, without children.
+func (f *FS) memberNode(idx *archiveIndex, m *archiveMember, password string) *Node {
+	archivePath := f.Rel(idx.path)
+	n := &Node{
+		Name:     pathpkg.Base(m.name),
+		Path:     filepath.Join(archivePath, filepath.FromSlash(m.name)),
+		ModTime:  m.modTime,
+		Mode:     m.mode,
+		IsDir:    m.isDir,
+		Size:     FileSize(m.size),
+		Password: password,
+		Files:    make([]*Node, 0),
+		Dirs:     make([]*Node, 0),
+		member:   &memberRef{idx, m},
+	}
+	n.Prev = filepath.Dir(n.Path)
+	if pathpkg.Dir(m.name) == "." {
+		// the parent is the root of the archive, listed with a trailing slash
+		n.Prev = archivePath + "/"
+	}
+	if m.name == "" {
+		n.Path = archivePath
+		n.Prev = filepath.Dir(archivePath)
+	}
+	return n
+}
+
+// OpenMember opens the archive member n for reading. The reader can seek, by reading the member again
+// from its start when seeking backwards.
+func (f *FS) OpenMember(n *Node) (io.ReadSeeker, io.Closer, error) {
+	if !n.InArchive() || n.IsDir {
+		return nil, nil, ErrFileNotFound
+	}
+	if f.Archives.MaxMemberSize > 0 && int64(n.Size) > f.Archives.MaxMemberSize {
+		return nil, nil, ErrMemberTooBig
+	}
+
+	r := &memberReader{idx: n.member.index, member: n.member.member}
+	return r, r, nil
+}
+
+// MemberSum returns the checksum of the archive member n with the algorithm, which isn't cached.
+func (f *FS) MemberSum(n *Node, algorithm string) ([]byte, error) {
+	newHash, ok := Algorithms[algorithm]
+	if !ok {
+		return nil, ErrUnknownAlgorithm
+	}
+	r, closer, err := f.OpenMember(n)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("couldn't read archive member: %s", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// memberReader reads an archive member, reopening it to seek backwards.
+type memberReader struct {
+	idx    *archiveIndex
+	member *archiveMember
+
+	rc     io.ReadCloser
+	pos    int64
+	offset int64
+}
+
+// open opens the member's content, positioned at its start.
+func (r *memberReader) open() (io.ReadCloser, error) {
+	if r.idx.kind == "zip" {
+		zr, err := zip.OpenReader(r.idx.path)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open zip archive: %s", err)
+		}
+		for _, f := range zr.File {
+			if f.Name != r.member.raw {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				zr.Close()
+				return nil, fmt.Errorf("couldn't open zip archive member: %s", err)
+			}
+			return readCloser{rc, func() error {
+				rc.Close()
+				return zr.Close()
+			}}, nil
+		}
+		zr.Close()
+		return nil, ErrFileNotFound
+	}
+
+	tr, closer, err := openTar(r.idx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			closer()
+			return nil, ErrFileNotFound
+		}
+		if h.Name == r.member.raw {
+			return readCloser{tr, closer}, nil
+		}
+	}
+}
+
+func (r *memberReader) Read(p []byte) (int, error) {
+	if r.offset >= r.member.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil || r.pos > r.offset {
+		r.Close()
+		rc, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.rc, r.pos = rc, 0
+	}
+	if r.pos < r.offset {
+		n, err := io.CopyN(ioutil.Discard, r.rc, r.offset-r.pos)
+		r.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if rest := r.member.size - r.offset; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *memberReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.member.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the archive member")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *memberReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
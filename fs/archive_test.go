@@ -0,0 +1,204 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"filekeep/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var archiveMembers = []struct{ name, content string }{
+	{"docs/readme.txt", "read me"},
+	{"docs/guide/intro.txt", "hello from inside"},
+	{"top.txt", "top"},
+	{"../escape.txt", "zip slip"},
+	{"/etc/passwd", "absolute"},
+	{"docs/.secret", "hidden"},
+}
+
+func writeZip(t *testing.T, path string) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, m := range archiveMembers {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(m.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTgz(t *testing.T, path string) {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, m := range archiveMembers {
+		h := &tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(m.content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	tw.Close()
+	gz.Close()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchives(t *testing.T) {
+	root, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeZip(t, filepath.Join(root, "bundle.zip"))
+	writeTgz(t, filepath.Join(root, "bundle.tar.gz"))
+
+	f := New(root, config.HideRules{}, nil)
+	f.Archives = NewArchives(0, 0, 0)
+
+	for _, name := range []string{"bundle.zip", "bundle.tar.gz"} {
+		archive := filepath.Join(root, name)
+		n, err := f.Read(archive)
+		if err != nil || !n.IsArchive || n.IsDir {
+			t.Fatalf("%s: expected an archive file, got %+v, %v", name, n, err)
+		}
+
+		n, err = f.ReadArchive(archive)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !n.IsDir || len(n.Dirs) != 1 || len(n.Files) != 1 || n.Files[0].Name != "top.txt" {
+			t.Fatalf("%s: expected the root to list docs and top.txt only, got %+v", name, n)
+		}
+		if prev := n.Files[0].Prev; prev != "/"+name+"/" {
+			t.Errorf("%s: expected top-level members to go back to %q, got %q", name, "/"+name+"/", prev)
+		}
+
+		docs, err := f.Read(filepath.Join(archive, "docs"))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(docs.Files) != 1 || docs.Files[0].Name != "readme.txt" || len(docs.Dirs) != 1 || len(docs.Dirs[0].Files) != 1 {
+			t.Errorf("%s: expected docs to list readme.txt and guide/intro.txt only, got %+v", name, docs)
+		}
+
+		for _, missing := range []string{"escape.txt", "etc/passwd", "docs/.secret", "link", "nope"} {
+			if _, err := f.Read(filepath.Join(archive, missing)); err != ErrFileNotFound {
+				t.Errorf("%s: expected %s not to be found, got %v", name, missing, err)
+			}
+		}
+
+		intro, err := f.Read(filepath.Join(archive, "docs", "guide", "intro.txt"))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if intro.Path != filepath.Join("/", name, "docs", "guide", "intro.txt") || !intro.InArchive() {
+			t.Errorf("%s: unexpected member node %+v", name, intro)
+		}
+
+		r, closer, err := f.OpenMember(intro)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		r.Seek(11, io.SeekStart)
+		tail, _ := ioutil.ReadAll(r)
+		r.Seek(0, io.SeekStart)
+		head := make([]byte, 5)
+		io.ReadFull(r, head)
+		closer.Close()
+		if string(tail) != "inside" || string(head) != "hello" {
+			t.Errorf("%s: expected seeking to read %q and %q, got %q and %q", name, "inside", "hello", tail, head)
+		}
+	}
+
+	f.Archives = NewArchives(0, 0, 5)
+	n, err := f.Read(filepath.Join(root, "bundle.zip", "top.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.OpenMember(n); err != nil {
+		t.Errorf("expected a member under the size limit to open, got %v", err)
+	}
+	n, _ = f.Read(filepath.Join(root, "bundle.zip", "docs", "readme.txt"))
+	if _, _, err := f.OpenMember(n); err != ErrMemberTooBig {
+		t.Errorf("expected ErrMemberTooBig, got %v", err)
+	}
+
+	f.Archives = NewArchives(0, 3, 0)
+	if _, err := f.ReadArchive(filepath.Join(root, "bundle.zip")); err != ErrFileNotFound {
+		t.Errorf("expected archives over MaxMembers not to be browsable, got %v", err)
+	}
+}
+
+func TestArchiveHiddenAndDuplicates(t *testing.T) {
+	root, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, m := range []struct{ name, content string }{{"a.txt", "first"}, {"a.txt", "the second one"}, {"b", "file"}, {"b/", ""}} {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(m.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dup.zip", "secret.zip", ".dot.zip"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := New(root, config.HideRules{Hidden: []string{"secret.zip"}}, nil)
+	f.Archives = NewArchives(0, 0, 0)
+
+	for _, name := range []string{"secret.zip", ".dot.zip"} {
+		if _, err := f.Read(filepath.Join(root, name, "a.txt")); err != ErrFileNotFound {
+			t.Errorf("expected the members of the hidden %s not to be found, got %v", name, err)
+		}
+	}
+
+	n, err := f.Read(filepath.Join(root, "dup.zip", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, closer, err := f.OpenMember(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	closer.Close()
+	if string(b) != "first" || int64(n.Size) != int64(len("first")) {
+		t.Errorf("expected the first entry of a duplicate name, got %q of size %d", b, n.Size)
+	}
+
+	n, err = f.Read(filepath.Join(root, "dup.zip", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.IsDir || n.Mode.IsDir() {
+		t.Errorf("expected the first entry of b to stay a file, got %+v", n)
+	}
+}
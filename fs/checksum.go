@@ -0,0 +1,190 @@
+package fs
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"filekeep/metrics"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	pathpkg "path"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrUnknownAlgorithm is returned for checksums of an algorithm not in Algorithms.
+var ErrUnknownAlgorithm = errors.New("unknown checksum algorithm")
+
+// Algorithms are the supported checksum algorithms, by name.
+var Algorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New512(nil)
+		return h
+	},
+}
+
+// Manifests maps the names of checksum manifests, as written by the coreutils tools, to their algorithm.
+var Manifests = map[string]string{
+	"SHA256SUMS": "sha256",
+	"SHA1SUMS":   "sha1",
+	"MD5SUMS":    "md5",
+	"B2SUMS":     "blake2b",
+}
+
+// AlgorithmNames returns the names of the supported algorithms, sorted.
+func AlgorithmNames() []string {
+	var names []string
+	for name := range Algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type checksumKey struct {
+	path      string
+	size      int64
+	modTime   int64
+	algorithm string
+}
+
+// Checksums computes the checksums of files, and caches them by path, size and modification time.
+// Safe for concurrent use.
+type Checksums struct {
+	// MaxEntries is the number of cached checksums, over which random ones are forgotten.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[checksumKey][]byte
+}
+
+// NewChecksums returns a Checksums caching up to maxEntries checksums.
+func NewChecksums(maxEntries int) *Checksums {
+	return &Checksums{MaxEntries: maxEntries, entries: make(map[checksumKey][]byte)}
+}
+
+func keyOf(path string, info os.FileInfo, algorithm string) checksumKey {
+	return checksumKey{path, info.Size(), info.ModTime().UnixNano(), algorithm}
+}
+
+// Cached returns the checksum of the file at path described by info, if it's cached.
+func (c *Checksums) Cached(path string, info os.FileInfo, algorithm string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sum, ok := c.entries[keyOf(path, info, algorithm)]
+	return sum, ok
+}
+
+// Sum returns the checksum of the file at path with the algorithm, computing it if it isn't cached.
+func (c *Checksums) Sum(path, algorithm string) ([]byte, error) {
+	newHash, ok := Algorithms[algorithm]
+	if !ok {
+		return nil, ErrUnknownAlgorithm
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open file for checksum: %s", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't stat file for checksum: %s", err)
+	}
+	if info.IsDir() {
+		return nil, ErrFileNotFound
+	}
+
+	if sum, ok := c.Cached(path, info, algorithm); ok {
+		metrics.CacheHit("checksums")
+		return sum, nil
+	}
+	metrics.CacheMiss("checksums")
+
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("couldn't read file for checksum: %s", err)
+	}
+	sum := h.Sum(nil)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if len(c.entries) < c.MaxEntries {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[keyOf(path, info, algorithm)] = sum
+	return sum, nil
+}
+
+// Hex returns the checksum of the file at path as a hex string, like Sum.
+func (c *Checksums) Hex(path, algorithm string) (string, error) {
+	sum, err := c.Sum(path, algorithm)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// ManifestDepth is the depth of the manifests served without an API token, reaching as far as the listings:
+// the files of the directory and of its children.
+const ManifestDepth = dirLimit - 1
+
+// Manifest calls fn with the path relative to dir and the checksum of every file under the directory
+// at dir, in order, like "sha256sum" would list them. Hidden and password protected files are skipped,
+// and so are the subdirectories more than depth levels down, unless depth is negative.
+func (f *FS) Manifest(dir, algorithm string, depth int, sums *Checksums, fn func(path, sum string) error) error {
+	if _, ok := Algorithms[algorithm]; !ok {
+		return ErrUnknownAlgorithm
+	}
+	return f.manifest(dir, "", algorithm, depth, sums, fn)
+}
+
+func (f *FS) manifest(dir, rel, algorithm string, depth int, sums *Checksums, fn func(path, sum string) error) error {
+	ls, err := f.readDir(dir)
+	if err != nil {
+		return ErrDirNotFound
+	}
+
+	for _, e := range ls {
+		path, info := e.path, e.info
+		if f.IsHidden(path, info.Name()) || f.newNode(path, info).Password != "" {
+			continue
+		}
+
+		name := pathpkg.Join(rel, info.Name())
+		if info.IsDir() {
+			if depth == 0 {
+				continue
+			}
+			if err := f.manifest(path, name, algorithm, depth-1, sums, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		sum, err := sums.Hex(path, algorithm)
+		if err != nil {
+			return err
+		}
+		if err := fn(name, sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrQuotaExceeded is returned by Extract and Compress when they'd write more than their Limits.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrExists is returned by Extract and Compress when their destination already exists.
+	ErrExists = errors.New("destination already exists")
+	// ErrNotArchive is returned for file names without a supported archive extension.
+	ErrNotArchive = errors.New("not a zip or tar archive")
+)
+
+// Progress receives the progress of Extract and Compress.
+type Progress interface {
+	// SetTotal is called once with the total size and number of files to write.
+	SetTotal(bytes int64, files int)
+	// Add is called as bytes and files are written.
+	Add(bytes int64, files int)
+}
+
+type nopProgress struct{}
+
+func (nopProgress) SetTotal(int64, int) {}
+func (nopProgress) Add(int64, int)      {}
+
+// Limits caps what Extract and Compress write, as a protection against archive bombs and full disks.
+type Limits struct {
+	// MaxSize is the total size in bytes of the files written. 0 disables the limit.
+	MaxSize int64
+	// MaxFiles is the number of files written. 0 disables the limit.
+	MaxFiles int
+}
+
+// check returns ErrQuotaExceeded if size and files are over the limits.
+func (l Limits) check(size int64, files int) error {
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return fmt.Errorf("%s: %s over the limit of %s", ErrQuotaExceeded, FileSize(size), FileSize(l.MaxSize))
+	}
+	if l.MaxFiles > 0 && files > l.MaxFiles {
+		return fmt.Errorf("%s: %d files over the limit of %d", ErrQuotaExceeded, files, l.MaxFiles)
+	}
+	return nil
+}
+
+// progressWriter writes to w, reporting the progress to p, until ctx is done or the size limit is reached.
+type progressWriter struct {
+	ctx context.Context
+	w   io.Writer
+	p   Progress
+	// left is the number of bytes left to write, negative for no limit.
+	left int64
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	if err := pw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if pw.left >= 0 && int64(len(b)) > pw.left {
+		return 0, ErrQuotaExceeded
+	}
+
+	n, err := pw.w.Write(b)
+	if pw.left >= 0 {
+		pw.left -= int64(n)
+	}
+	pw.p.Add(int64(n), 0)
+	return n, err
+}
+
+// Extract extracts the archive at path into the directory dest, which mustn't exist, within the limits.
+// The members are extracted next to dest first, and only moved to dest once all of them are, so a failed
+// or cancelled extraction leaves nothing behind. Hidden members, links and members which would end up
+// outside of dest are skipped.
+func (f *FS) Extract(ctx context.Context, path, dest string, limits Limits, p Progress) error {
+	if p == nil {
+		p = nopProgress{}
+	}
+	if ArchiveKind(path) == "" {
+		return ErrNotArchive
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return ErrExists
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("couldn't stat archive: %s", err)
+	}
+	idx, err := readIndex(path, info, 0)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	var files int
+	for _, m := range idx.members {
+		if !m.isDir {
+			size += m.size
+			files++
+		}
+	}
+	if err := limits.check(size, files); err != nil {
+		return err
+	}
+	p.SetTotal(size, files)
+
+	tmp, err := ioutil.TempDir(filepath.Dir(dest), ".extract-")
+	if err != nil {
+		return fmt.Errorf("couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	x := &extractor{f: f, dir: tmp, archive: path, limits: limits, w: progressWriter{ctx: ctx, p: p, left: -1}}
+	if limits.MaxSize > 0 {
+		// the sizes in the headers can lie, the writer enforces the limit
+		x.w.left = limits.MaxSize
+	}
+	if idx.kind == "zip" {
+		err = x.zip()
+	} else {
+		err = x.tar(idx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// extractor extracts the members of an archive into dir.
+type extractor struct {
+	f       *FS
+	dir     string
+	archive string
+	limits  Limits
+	files   int
+	w       progressWriter
+	// dirs keeps the modification times of directories, set last as extracting their files changes them.
+	dirs map[string]time.Time
+}
+
+func (x *extractor) zip() error {
+	zr, err := zip.OpenReader(x.archive)
+	if err != nil {
+		return fmt.Errorf("couldn't open zip archive: %s", err)
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			continue
+		}
+
+		var r io.ReadCloser
+		if mode.IsRegular() {
+			if r, err = zf.Open(); err != nil {
+				return fmt.Errorf("couldn't open zip archive member: %s", err)
+			}
+		}
+		err := x.extract(zf.Name, mode, zf.Modified, r)
+		if r != nil {
+			r.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return x.finish()
+}
+
+func (x *extractor) tar(idx *archiveIndex) error {
+	tr, closer, err := openTar(idx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return x.finish()
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read tar archive: %s", err)
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = x.extract(h.Name, os.ModeDir|0755, h.ModTime, nil)
+		case tar.TypeReg:
+			err = x.extract(h.Name, h.FileInfo().Mode(), h.ModTime, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extract writes the member named name, a directory if r is nil.
+func (x *extractor) extract(name string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+	if err := x.w.ctx.Err(); err != nil {
+		return err
+	}
+
+	cleaned, ok := cleanMember(name)
+	if !ok {
+		x.f.Log.Debugf("skipping unsafe archive member %q of %q", name, x.archive)
+		return nil
+	}
+	target := filepath.Join(x.dir, filepath.FromSlash(cleaned))
+	if !strings.HasPrefix(target, x.dir+string(filepath.Separator)) {
+		return nil
+	}
+	if x.f.IsHidden(filepath.Join(x.archive, filepath.FromSlash(cleaned)), pathpkg.Base(cleaned)) {
+		return nil
+	}
+
+	if r == nil {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fmt.Errorf("couldn't create directory: %s", err)
+		}
+		if x.dirs == nil {
+			x.dirs = make(map[string]time.Time)
+		}
+		x.dirs[target] = modTime
+		return nil
+	}
+
+	x.files++
+	if err := x.limits.check(0, x.files); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("couldn't create directory: %s", err)
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		// the same name twice in the archive, keep the first one like browsing does
+		if os.IsExist(err) {
+			return nil
+		}
+		return fmt.Errorf("couldn't create file: %s", err)
+	}
+
+	x.w.w = out
+	_, err = io.Copy(&x.w, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == ErrQuotaExceeded {
+		return x.limits.check(x.limits.MaxSize+1, 0)
+	}
+	if err != nil {
+		return err
+	}
+	x.w.p.Add(0, 1)
+	return os.Chtimes(target, modTime, modTime)
+}
+
+func (x *extractor) finish() error {
+	for dir, modTime := range x.dirs {
+		os.Chtimes(dir, modTime, modTime)
+	}
+	return nil
+}
+
+// compressFile is a file or directory to add to an archive.
+type compressFile struct {
+	path string
+	name string
+	info os.FileInfo
+}
+
+// Compress writes the files and directories at paths, recursively, into a new archive at dest, its type
+// chosen from its extension. The members are named relative to the parent directory of each path.
+// The archive is written next to dest and renamed once complete. Hidden and password protected files
+// and directories are left out, the archive having no password of its own.
+func (f *FS) Compress(ctx context.Context, paths []string, dest string, limits Limits, p Progress) error {
+	if p == nil {
+		p = nopProgress{}
+	}
+	kind := ArchiveKind(dest)
+	if kind == "" {
+		return ErrNotArchive
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return ErrExists
+	}
+
+	var files []compressFile
+	var size int64
+	var count int
+	for _, path := range paths {
+		base := filepath.Dir(path)
+		err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if f.IsHidden(p, info.Name()) || f.newNode(p, info).Password != "" || p == dest {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+
+			name, _ := filepath.Rel(base, p)
+			files = append(files, compressFile{p, filepath.ToSlash(name), info})
+			if !info.IsDir() {
+				size += info.Size()
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't list files to compress: %s", err)
+		}
+	}
+	if err := limits.check(size, count); err != nil {
+		return err
+	}
+	p.SetTotal(size, count)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), ".compress-")
+	if err != nil {
+		return fmt.Errorf("couldn't create temporary file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// the files may have grown since they were walked
+	pw := &progressWriter{ctx: ctx, p: p, left: -1}
+	if limits.MaxSize > 0 {
+		pw.left = limits.MaxSize
+	}
+	if kind == "zip" {
+		err = compressZip(tmp, files, pw)
+	} else {
+		err = compressTar(tmp, kind == "tgz", files, pw)
+	}
+	if err == ErrQuotaExceeded {
+		return limits.check(limits.MaxSize+1, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// copyFile copies the file at path to w through pw, counting it against the bytes left to write.
+func copyFile(pw *progressWriter, w io.Writer, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	pw.w = w
+	if _, err := io.Copy(pw, in); err != nil {
+		return err
+	}
+	pw.p.Add(0, 1)
+	return nil
+}
+
+func compressZip(w io.Writer, files []compressFile, pw *progressWriter) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		h, err := zip.FileInfoHeader(file.info)
+		if err != nil {
+			return err
+		}
+		h.Name = file.name
+		if file.info.IsDir() {
+			h.Name += "/"
+		} else {
+			h.Method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if file.info.IsDir() {
+			continue
+		}
+		if err := copyFile(pw, fw, file.path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func compressTar(w io.Writer, gz bool, files []compressFile, pw *progressWriter) error {
+	var gzw *gzip.Writer
+	if gz {
+		gzw = gzip.NewWriter(w)
+		w = gzw
+	}
+
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		h, err := tar.FileInfoHeader(file.info, "")
+		if err != nil {
+			return err
+		}
+		h.Name = file.name
+		if file.info.IsDir() {
+			h.Name += "/"
+		}
+		// the owners on the server mean nothing to whoever downloads the archive
+		h.Uid, h.Gid, h.Uname, h.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if file.info.IsDir() {
+			continue
+		}
+		if err := copyFile(pw, tw, file.path); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gzw != nil {
+		return gzw.Close()
+	}
+	return nil
+}
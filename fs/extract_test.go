@@ -0,0 +1,113 @@
+package fs
+
+import (
+	"context"
+	"filekeep/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type countProgress struct {
+	bytes, totalBytes int64
+	files, totalFiles int
+}
+
+func (p *countProgress) SetTotal(bytes int64, files int) { p.totalBytes, p.totalFiles = bytes, files }
+func (p *countProgress) Add(bytes int64, files int)      { p.bytes += bytes; p.files += files }
+
+func TestExtractCompress(t *testing.T) {
+	root, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeZip(t, filepath.Join(root, "bundle.zip"))
+	writeTgz(t, filepath.Join(root, "bundle.tgz"))
+	f := New(root, config.HideRules{}, nil)
+	ctx := context.Background()
+
+	for _, name := range []string{"bundle.zip", "bundle.tgz"} {
+		dest := filepath.Join(root, strings.Replace(name, ".", "-", 1))
+		p := new(countProgress)
+		if err := f.Extract(ctx, filepath.Join(root, name), dest, Limits{}, p); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dest, "docs", "guide", "intro.txt"))
+		if err != nil || string(b) != "hello from inside" {
+			t.Errorf("%s: expected the member to be extracted, got %q, %v", name, b, err)
+		}
+		for _, unsafe := range []string{filepath.Join(root, "escape.txt"), filepath.Join(dest, "etc"), filepath.Join(dest, "docs", ".secret"), filepath.Join(dest, "link")} {
+			if _, err := os.Lstat(unsafe); err == nil {
+				t.Errorf("%s: expected %s not to be extracted", name, unsafe)
+			}
+		}
+		if p.files != 3 || p.bytes != int64(len("read me")+len("hello from inside")+len("top")) {
+			t.Errorf("%s: unexpected progress %+v", name, p)
+		}
+
+		if err := f.Extract(ctx, filepath.Join(root, name), dest, Limits{}, nil); err != ErrExists {
+			t.Errorf("%s: expected ErrExists, got %v", name, err)
+		}
+	}
+
+	dest := filepath.Join(root, "small")
+	if err := f.Extract(ctx, filepath.Join(root, "bundle.zip"), dest, Limits{MaxSize: 10}, nil); err == nil || !strings.Contains(err.Error(), ErrQuotaExceeded.Error()) {
+		t.Errorf("expected the quota to be exceeded, got %v", err)
+	}
+	if ls, _ := ioutil.ReadDir(root); len(ls) != 4 {
+		t.Errorf("expected a failed extraction to leave nothing behind, got %d entries", len(ls))
+	}
+
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz"} {
+		out := filepath.Join(root, name)
+		paths := []string{filepath.Join(root, "bundle-zip", "docs"), filepath.Join(root, "bundle-zip", "top.txt")}
+		if err := f.Compress(ctx, paths, out, Limits{}, nil); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		dest := filepath.Join(root, "from-"+name)
+		if err := f.Extract(ctx, out, dest, Limits{}, nil); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dest, "docs", "guide", "intro.txt"))
+		if err != nil || string(b) != "hello from inside" {
+			t.Errorf("%s: expected the files to round trip, got %q, %v", name, b, err)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "top.txt")); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	docs := filepath.Join(root, "bundle-zip", "docs")
+	if err := SetPassword(filepath.Join(docs, "guide"), "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	p := new(countProgress)
+	if err := f.Compress(ctx, []string{docs}, filepath.Join(root, "docs.zip"), Limits{}, p); err != nil {
+		t.Fatal(err)
+	}
+	if p.totalFiles != 1 {
+		t.Errorf("expected the protected directory to be left out, got %d files", p.totalFiles)
+	}
+
+	// a file grown since the walk still counts against the limit
+	intro := filepath.Join(docs, "guide", "intro.txt")
+	info, err := os.Stat(intro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw := &progressWriter{ctx: ctx, p: nopProgress{}, left: 5}
+	if err := compressZip(ioutil.Discard, []compressFile{{intro, "intro.txt", info}}, pw); err != ErrQuotaExceeded {
+		t.Errorf("expected the quota to be exceeded while writing, got %v", err)
+	}
+
+	err = f.Compress(ctx, []string{root}, filepath.Join(root, "all.zip"), Limits{MaxFiles: 2}, nil)
+	if err == nil || !strings.Contains(err.Error(), ErrQuotaExceeded.Error()) {
+		t.Errorf("expected the quota to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package fs
+
+import (
+	"filekeep/config"
+	"filekeep/helpers"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mount returns the mount holding the path on disk, if any.
+func (f *FS) mount(path string) (config.Mount, bool) {
+	for _, m := range f.Mounts {
+		mountPath := filepath.Clean(m.Path)
+		if path == mountPath || strings.HasPrefix(path, mountPath+string(filepath.Separator)) {
+			return m, true
+		}
+	}
+	return config.Mount{}, false
+}
+
+// Join returns the path on disk of the URL path name, which can't escape the root, or the mount
+// named by its first segment.
+func (f *FS) Join(name string) string {
+	name = filepath.Clean("/" + filepath.FromSlash(name))
+	for _, m := range f.Mounts {
+		mountName := string(filepath.Separator) + m.Name
+		if name == mountName || strings.HasPrefix(name, mountName+string(filepath.Separator)) {
+			return filepath.Join(m.Path, strings.TrimPrefix(name, mountName))
+		}
+	}
+	return filepath.Join(f.Root, name[1:])
+}
+
+// Rel returns the path of the path on disk relative to the root, as in Node.Path, the paths in the
+// mounts being under their names.
+func (f *FS) Rel(path string) string {
+	return helpers.TrimMounts(f.Root, f.Mounts, path)
+}
+
+// IsHidden returns whether the path on disk is hidden by the rules of its mount, or of the root.
+// The names are checked too, like IsHidden of the rules.
+func (f *FS) IsHidden(path string, names ...string) bool {
+	rules := f.Rules
+	if m, ok := f.mount(path); ok {
+		rules = m.HideRules
+	}
+	return rules.IsHidden(append([]string{path}, names...)...)
+}
+
+// IsRoot returns whether the path on disk is the root or the directory of a mount, which can't be
+// replaced, moved or deleted.
+func (f *FS) IsRoot(path string) bool {
+	if path == f.Root {
+		return true
+	}
+	m, ok := f.mount(path)
+	return ok && path == filepath.Clean(m.Path)
+}
+
+// ReadOnly returns whether the path on disk is in a read-only mount.
+func (f *FS) ReadOnly(path string) bool {
+	m, ok := f.mount(path)
+	return ok && m.ReadOnly
+}
+
+// entry is a file or directory listed by readDir, at its path on disk.
+type entry struct {
+	path string
+	info os.FileInfo
+}
+
+// mountInfo is the os.FileInfo of the directory of a mount, named after the mount.
+type mountInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i mountInfo) Name() string {
+	return i.name
+}
+
+// readDir lists the directory at path, sorted by name like ioutil.ReadDir. The mounts are listed in
+// the root, shadowing its entries named the same, and the ones missing on disk are left out.
+func (f *FS) readDir(path string) ([]entry, error) {
+	ls, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mounted := make(map[string]bool)
+	var entries []entry
+	if path == f.Root {
+		for _, m := range f.Mounts {
+			info, err := os.Stat(m.Path)
+			if err != nil || !info.IsDir() {
+				f.Log.Debugf("couldn't list mount %q at %q", m.Name, m.Path)
+				continue
+			}
+			mounted[m.Name] = true
+			entries = append(entries, entry{filepath.Clean(m.Path), mountInfo{info, m.Name}})
+		}
+	}
+	for _, info := range ls {
+		if !mounted[info.Name()] {
+			entries = append(entries, entry{filepath.Join(path, info.Name()), info})
+		}
+	}
+	if len(mounted) > 0 {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].info.Name() < entries[j].info.Name() })
+	}
+	return entries, nil
+}
@@ -0,0 +1,59 @@
+package fs
+
+import (
+	"filekeep/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"root/a.txt", "root/disk/shadowed.txt", "disk/sub/b.txt", "disk/c.bak"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, disk := filepath.Join(dir, "root"), filepath.Join(dir, "disk")
+	f := New(root, config.HideRules{}, nil)
+	f.Mounts = []config.Mount{{Name: "disk", Path: disk, HideRules: config.HideRules{HiddenExts: []string{".bak"}}, ReadOnly: true}}
+
+	if got := f.Join("/disk/sub/b.txt"); got != filepath.Join(disk, "sub", "b.txt") {
+		t.Errorf("expected the mount to be joined, got %q", got)
+	}
+	if got := f.Join("/a.txt"); got != filepath.Join(root, "a.txt") {
+		t.Errorf("expected the root to be joined, got %q", got)
+	}
+
+	n, err := f.Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Dirs) != 1 || n.Dirs[0].Name != "disk" || n.Dirs[0].Path != "/disk" || len(n.Dirs[0].Files) != 0 || len(n.Dirs[0].Dirs) != 1 {
+		t.Fatalf("expected the mount to shadow the directory of the root, got %s", n.JSON())
+	}
+	if n.Dirs[0].Dirs[0].Path != "/disk/sub" {
+		t.Errorf("expected the paths in the mount to be under its name, got %q", n.Dirs[0].Dirs[0].Path)
+	}
+
+	if !f.IsHidden(filepath.Join(disk, "c.bak")) || f.IsHidden(filepath.Join(root, "c.bak")) {
+		t.Error("expected the rules of the mount to apply in the mount only")
+	}
+	if !f.IsRoot(disk) || f.IsRoot(filepath.Join(disk, "sub")) {
+		t.Error("expected the directory of the mount to be a root")
+	}
+	if !f.ReadOnly(filepath.Join(disk, "sub")) || f.ReadOnly(filepath.Join(root, "a.txt")) {
+		t.Error("expected the mount only to be read-only")
+	}
+}
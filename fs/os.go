@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"filekeep/config"
-	"filekeep/helpers"
+	"filekeep/metrics"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -54,6 +56,12 @@ type Node struct {
 	// Dirs keeps all children directories of a directory, or a slice of empty Nodes if it's a child directory
 	// ir order to show how many children the directory has.
 	Dirs []*Node `json:"dirs,omitempty"`
+	// Usage is the recursive size and item count of a directory, if computed.
+	Usage *Usage `json:"usage,omitempty"`
+	// IsArchive tells the file is an archive which can be browsed as a directory.
+	IsArchive bool `json:"is_archive,omitempty"`
+
+	member *memberRef
 }
 
 // JSON returns the node as a JSON encoded string.
@@ -67,15 +75,105 @@ func (n *Node) JSON() string {
 
 // HasPassword returns if a node has the specified password set.
 func (n *Node) HasPassword(s string) bool {
-	sum := md5.Sum([]byte(s))
-	return n.Password == fmt.Sprintf("%x", sum)
+	return n.Password == hashPassword(s)
+}
+
+func hashPassword(s string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(s)))
+}
+
+// PasswordFile returns the file holding the password of the file or directory at path,
+// named the same with a prepended dot, next to it.
+func PasswordFile(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path))
+}
+
+// SetPassword protects the file or directory at path with the password.
+func SetPassword(path, password string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("couldn't protect %q: %s", path, err)
+	}
+	if err := ioutil.WriteFile(PasswordFile(path), []byte(hashPassword(password)+"\n"), 0600); err != nil {
+		return fmt.Errorf("couldn't write password file: %s", err)
+	}
+	return nil
+}
+
+// RemovePassword removes the password of the file or directory at path. It's not an error if there's none.
+func RemovePassword(path string) error {
+	if err := os.Remove(PasswordFile(path)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("couldn't remove password file: %s", err)
+	}
+	return nil
+}
+
+// Version returns a hash of the node and its children's names, modification times, sizes and modes,
+// which changes whenever the listing of the node would.
+func (n *Node) Version() string {
+	h := fnv.New64a()
+	n.hash(h)
+	return fmt.Sprintf("%x", h.Sum64())
 }
 
-func newNode(path string, info os.FileInfo) *Node {
+func (n *Node) hash(w io.Writer) {
+	fmt.Fprintf(w, "%s\x00%d\x00%d\x00%d\x00%t\x00%t\x00%d\x00%d\x00",
+		n.Name, n.ModTime.UnixNano(), n.Size, n.Mode, n.IsDir, n.Password != "", len(n.Files), len(n.Dirs))
+	if n.Usage != nil {
+		fmt.Fprintf(w, "%+v\x00", *n.Usage)
+	}
+	for _, child := range n.Files {
+		child.hash(w)
+	}
+	for _, child := range n.Dirs {
+		child.hash(w)
+	}
+}
+
+// LastModified returns the latest modification time of the node and its direct children.
+func (n *Node) LastModified() time.Time {
+	t := n.ModTime
+	for _, children := range [][]*Node{n.Files, n.Dirs} {
+		for _, child := range children {
+			if child.ModTime.After(t) {
+				t = child.ModTime
+			}
+		}
+	}
+	return t
+}
+
+// FS reads nodes from the Root directory, hiding the paths matched by Rules.
+type FS struct {
+	// Root is the root directory. Defaults to ".", the runtime dir.
+	Root string
+	// Rules decide which files and directories are hidden, except in the mounts.
+	Rules config.HideRules
+	// Mounts are the directories presented as top-level directories of the root, with their own rules.
+	Mounts []config.Mount
+	// Log receives the debugging output. Defaults to the logrus standard logger.
+	Log logrus.FieldLogger
+	// Sizes computes the recursive sizes of the directories read, if set.
+	Sizes *Sizes
+	// Archives makes archives browsable as directories, if set.
+	Archives *Archives
+}
+
+// New returns a FS for the root directory, hiding the paths matched by rules.
+func New(root string, rules config.HideRules, log logrus.FieldLogger) *FS {
+	if root == "" {
+		root = "."
+	}
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+	return &FS{Root: root, Rules: rules, Log: log}
+}
+
+func (f *FS) newNode(path string, info os.FileInfo) *Node {
 	n := &Node{
 		Name:    filepath.Base(path),
-		Path:    helpers.StripRoot(path),
-		Prev:    filepath.Dir(helpers.StripRoot(path)),
+		Path:    f.Rel(path),
+		Prev:    filepath.Dir(f.Rel(path)),
 		ModTime: info.ModTime(),
 		Mode:    info.Mode(),
 		Size:    FileSize(info.Size()),
@@ -84,47 +182,51 @@ func newNode(path string, info os.FileInfo) *Node {
 		Dirs:    make([]*Node, 0),
 	}
 
-	if path == config.Get().Root {
+	if path == f.Root {
 		n.Name = "."
 		n.Path = "."
+	} else if m, ok := f.mount(path); ok && path == filepath.Clean(m.Path) {
+		n.Name = m.Name
+	}
+	if f.Archives != nil && info.Mode().IsRegular() {
+		n.IsArchive = ArchiveKind(n.Name) != ""
 	}
 
-	passFile := filepath.Join(filepath.Dir(path), "."+filepath.Base(path))
-	pass, err := ioutil.ReadFile(passFile)
+	pass, err := ioutil.ReadFile(PasswordFile(path))
 	if err != nil {
 		return n
 	}
 
 	n.Password = strings.Trim(string(pass), "\n")
-	logrus.Debugf("read password %q for file %q", n.Password, n.Name)
+	f.Log.Debugf("read password %q for file %q", n.Password, n.Name)
 	return n
 }
 
-func lsDir(path string, info os.FileInfo, count int) (*Node, error) {
+func (f *FS) lsDir(path string, info os.FileInfo, count int) (*Node, error) {
 	if count > dirLimit {
 		return nil, ErrDirLimit
 	}
 	count++
 
-	fd := newNode(path, info)
+	fd := f.newNode(path, info)
 
-	ls, err := ioutil.ReadDir(path)
+	ls, err := f.readDir(path)
 	if err != nil {
-		logrus.Debugf("error calling ioutil.ReadDir on path %q, returning ErrDirNotFound", path)
+		f.Log.Debugf("error calling ioutil.ReadDir on path %q, returning ErrDirNotFound", path)
 		return nil, ErrDirNotFound
 	}
 
-	for _, fileInfo := range ls {
-		filePath := filepath.Join(path, fileInfo.Name())
+	for _, e := range ls {
+		filePath, fileInfo := e.path, e.info
 
-		if config.Get().IsHidden(filePath, fileInfo.Name()) {
-			logrus.Debugf("path %q or %q is hidden, continuing lsDir loop", fileInfo.Name(), path)
+		if f.IsHidden(filePath, fileInfo.Name()) {
+			f.Log.Debugf("path %q or %q is hidden, continuing lsDir loop", fileInfo.Name(), path)
 			continue
 		}
 
-		file := newNode(filePath, fileInfo)
+		file := f.newNode(filePath, fileInfo)
 		if file.IsDir {
-			subDir, err := lsDir(filePath, fileInfo, count)
+			subDir, err := f.lsDir(filePath, fileInfo, count)
 			if err != nil {
 				continue
 			}
@@ -138,24 +240,84 @@ func lsDir(path string, info os.FileInfo, count int) (*Node, error) {
 	return fd, nil
 }
 
+// setUsage sets the usage of the directory fd at path, and of its child directories.
+func (f *FS) setUsage(path string, fd *Node) {
+	u := f.Sizes.Get(path, fd.ModTime)
+	fd.Usage = &u
+	for _, d := range fd.Dirs {
+		u := f.Sizes.Get(filepath.Join(path, d.Name), d.ModTime)
+		d.Usage = &u
+	}
+}
+
 // Read checks if a path is hidden, and if not, will return its Node or an error if it fails.
-func Read(path string) (fd *Node, err error) {
-	if config.Get().IsHidden(path) {
-		logrus.Debugf("path %q is hidden, returning ErrFileNotFound", path)
+func (f *FS) Read(path string) (fd *Node, err error) {
+	if f.IsHidden(path) {
+		f.Log.Debugf("path %q is hidden, returning ErrFileNotFound", path)
 		return nil, ErrFileNotFound
 	}
 
 	info, err := os.Stat(path)
+	if err != nil && f.Archives != nil {
+		return f.readArchive(path)
+	}
 	if err != nil {
-		logrus.Debugf("error calling os.Stat on path %q, returning ErrFileNotFound", path)
+		f.Log.Debugf("error calling os.Stat on path %q, returning ErrFileNotFound", path)
 		return nil, ErrFileNotFound
 	}
 
 	if info.IsDir() {
-		fd, err = lsDir(path, info, 0)
+		start := time.Now()
+		fd, err = f.lsDir(path, info, 0)
+		metrics.ListingDuration.Observe(time.Since(start).Seconds())
+		if err == nil && f.Sizes != nil {
+			f.setUsage(path, fd)
+		}
 	} else {
-		fd = newNode(path, info)
+		fd = f.newNode(path, info)
 	}
 
 	return
 }
+
+// Stat checks if a path is hidden, and if not, will return its Node without its children.
+func (f *FS) Stat(path string) (*Node, error) {
+	if f.IsHidden(path) {
+		return nil, ErrFileNotFound
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+	return f.newNode(path, info), nil
+}
+
+// Concealed returns whether the directory at path holds entries its listing doesn't show in full, which are
+// hidden or protected by a password, at any depth.
+func (f *FS) Concealed(path string) (bool, error) {
+	ls, err := f.readDir(path)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range ls {
+		if f.IsHidden(e.path, e.info.Name()) {
+			return true, nil
+		}
+		if _, err := os.Lstat(PasswordFile(e.path)); err == nil {
+			return true, nil
+		}
+		if e.info.IsDir() {
+			if concealed, err := f.Concealed(e.path); concealed || err != nil {
+				return concealed, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// Read checks if a path is hidden using the global config, and if not, will return its Node
+// or an error if it fails.
+func Read(path string) (*Node, error) {
+	c := config.Get()
+	return New(c.Root, c.HideRules, nil).Read(path)
+}
@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"filekeep/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetPassword(t *testing.T) {
+	root, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "a.txt")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPassword(filepath.Join(root, "missing"), "1234"); err == nil {
+		t.Error("expected protecting a missing file to fail")
+	}
+	if err := SetPassword(path, "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(root, config.HideRules{}, nil)
+	n, err := f.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Password != "81dc9bdb52d04dc20036dbd8313ed055" || !n.HasPassword("1234") {
+		t.Errorf("expected the password to be set, got %q", n.Password)
+	}
+
+	if err := RemovePassword(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemovePassword(path); err != nil {
+		t.Errorf("expected removing a missing password to succeed, got %s", err)
+	}
+	if n, _ := f.Read(path); n.Password != "" {
+		t.Errorf("expected the password to be removed, got %q", n.Password)
+	}
+}
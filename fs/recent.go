@@ -0,0 +1,49 @@
+package fs
+
+import (
+	"sort"
+)
+
+// Recent returns the most recently modified files under the directory at path, looking down to depth
+// levels of subdirectories, the newest first and at most limit of them. Hidden files, and protected
+// files and directories, are left out.
+func (f *FS) Recent(path string, depth, limit int) ([]*Node, error) {
+	n, err := f.Stat(path)
+	if err != nil || !n.IsDir {
+		return nil, ErrDirNotFound
+	}
+
+	var files []*Node
+	var walk func(dir string, level int)
+	walk = func(dir string, level int) {
+		ls, err := f.readDir(dir)
+		if err != nil {
+			f.Log.Debugf("couldn't list %q for the recent files: %s", dir, err)
+			return
+		}
+		for _, e := range ls {
+			p, info := e.path, e.info
+			if f.IsHidden(p, info.Name()) {
+				continue
+			}
+			child := f.newNode(p, info)
+			if child.Password != "" {
+				continue
+			}
+			if child.IsDir {
+				if level < depth {
+					walk(p, level+1)
+				}
+			} else if info.Mode().IsRegular() {
+				files = append(files, child)
+			}
+		}
+	}
+	walk(path, 0)
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].ModTime.After(files[j].ModTime) })
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
@@ -0,0 +1,231 @@
+package fs
+
+import (
+	"filekeep/metrics"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sizesWorkers is the number of directories walked at the same time.
+const sizesWorkers = 2
+
+// Usage is the recursive size and item count of a directory.
+type Usage struct {
+	// Size is the summed size of all files under the directory.
+	Size FileSize `json:"size"`
+	// Files is the number of files under the directory.
+	Files int `json:"files"`
+	// Dirs is the number of directories under the directory.
+	Dirs int `json:"dirs"`
+	// Pending tells the usage is being computed, and is either zero or outdated until then.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// sizesEntry is the cached usage of a directory, valid while its modification time doesn't change.
+type sizesEntry struct {
+	usage    Usage
+	modTime  time.Time
+	computed time.Time
+}
+
+// Sizes computes the recursive usage of directories with background walks, and caches it by
+// directory and modification time. Safe for concurrent use.
+type Sizes struct {
+	// MaxAge is how long a computed usage is served before it's walked again, as changes deeper
+	// in the tree don't change the modification time of the directory. 0 never walks again.
+	MaxAge time.Duration
+
+	fs      *FS
+	mu      sync.Mutex
+	entries map[string]*sizesEntry
+	walking map[string]chan struct{}
+	sem     chan struct{}
+}
+
+// NewSizes returns the Sizes of the directories of f, walked again after maxAge.
+func NewSizes(f *FS, maxAge time.Duration) *Sizes {
+	return &Sizes{
+		MaxAge:  maxAge,
+		fs:      f,
+		entries: make(map[string]*sizesEntry),
+		walking: make(map[string]chan struct{}),
+		sem:     make(chan struct{}, sizesWorkers),
+	}
+}
+
+// Get returns the usage of the directory at path, which is pending if it's not known yet or outdated,
+// in which case a background walk is started.
+func (s *Sizes) Get(path string, modTime time.Time) Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[path]
+	fresh := ok && e.modTime.Equal(modTime) && (s.MaxAge <= 0 || time.Since(e.computed) < s.MaxAge)
+	if fresh {
+		metrics.CacheHit("dir_sizes")
+		return e.usage
+	}
+	metrics.CacheMiss("dir_sizes")
+
+	if !s.isWalking(path) {
+		done := make(chan struct{})
+		s.walking[path] = done
+		go s.walk(path, done)
+	}
+
+	var u Usage
+	if ok {
+		u = e.usage
+	}
+	u.Pending = true
+	return u
+}
+
+// isWalking returns whether the directory at path or one of its parents is being walked. s.mu must be held.
+func (s *Sizes) isWalking(path string) bool {
+	for p := range s.walking {
+		if p == path || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until the walk of the directory at path, if any, is done.
+func (s *Sizes) Wait(path string) {
+	s.mu.Lock()
+	done, ok := s.walking[path]
+	s.mu.Unlock()
+	if ok {
+		<-done
+	}
+}
+
+// walk computes the usage of the directory at path, and of all the directories under it,
+// then forgets the directories under it that are gone.
+func (s *Sizes) walk(path string, done chan struct{}) {
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	start := time.Now()
+	s.usage(path)
+	s.fs.Log.Debugf("computed the size of %q in %s", path, time.Since(start))
+
+	s.mu.Lock()
+	prefix := path + string(filepath.Separator)
+	for p, e := range s.entries {
+		if strings.HasPrefix(p, prefix) && e.computed.Before(start) {
+			delete(s.entries, p)
+		}
+	}
+	delete(s.walking, path)
+	s.mu.Unlock()
+	close(done)
+}
+
+// usage walks the directory at path, caching the usage of every directory under it.
+func (s *Sizes) usage(path string) Usage {
+	var u Usage
+	info, err := os.Stat(path)
+	if err != nil {
+		return u
+	}
+
+	ls, err := s.fs.readDir(path)
+	if err != nil {
+		s.fs.Log.Debugf("error calling ioutil.ReadDir on path %q while computing its size", path)
+		return u
+	}
+
+	for _, e := range ls {
+		filePath, fileInfo := e.path, e.info
+		if s.fs.IsHidden(filePath, fileInfo.Name()) {
+			continue
+		}
+
+		if fileInfo.IsDir() {
+			sub := s.usage(filePath)
+			u.Size += sub.Size
+			u.Files += sub.Files
+			u.Dirs += sub.Dirs + 1
+		} else {
+			u.Size += FileSize(fileInfo.Size())
+			u.Files++
+		}
+	}
+
+	s.mu.Lock()
+	s.entries[path] = &sizesEntry{usage: u, modTime: info.ModTime(), computed: time.Now()}
+	s.mu.Unlock()
+	return u
+}
+
+// DiskEntry is a file or directory in a DiskUsage, with its recursive usage.
+type DiskEntry struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir"`
+	Usage
+}
+
+// DiskUsage is the recursive usage of a directory, and of each of its entries.
+type DiskUsage struct {
+	Path  string `json:"path"`
+	Usage Usage  `json:"usage"`
+	// Entries are the files and directories of the directory, largest first.
+	Entries []DiskEntry `json:"entries"`
+}
+
+// DiskUsage returns the usage of the directory at path and of its entries, hiding the paths matched
+// by the rules. Without Sizes, the directory is walked before returning.
+func (f *FS) DiskUsage(path string) (*DiskUsage, error) {
+	if f.IsHidden(path) {
+		return nil, ErrDirNotFound
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return nil, ErrDirNotFound
+	}
+	ls, err := f.readDir(path)
+	if err != nil {
+		return nil, ErrDirNotFound
+	}
+
+	sizes := f.Sizes
+	if sizes == nil {
+		sizes = NewSizes(f, 0)
+		sizes.usage(path)
+	}
+
+	du := &DiskUsage{Path: f.Rel(path), Usage: sizes.Get(path, info.ModTime())}
+	if path == f.Root {
+		du.Path = "."
+	}
+	for _, entry := range ls {
+		filePath, fileInfo := entry.path, entry.info
+		if f.IsHidden(filePath, fileInfo.Name()) {
+			continue
+		}
+
+		e := DiskEntry{Name: fileInfo.Name(), Path: f.Rel(filePath), IsDir: fileInfo.IsDir()}
+		if e.IsDir {
+			e.Usage = sizes.Get(filePath, fileInfo.ModTime())
+		} else {
+			e.Usage = Usage{Size: FileSize(fileInfo.Size()), Files: 1}
+		}
+		du.Entries = append(du.Entries, e)
+	}
+
+	sort.Slice(du.Entries, func(i, j int) bool {
+		a, b := du.Entries[i], du.Entries[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Name < b.Name
+	})
+	return du, nil
+}
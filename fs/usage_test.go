@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"filekeep/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSizes(t *testing.T) {
+	root, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]int{"a/b/c/deep.bin": 1000, "a/b/mid.bin": 100, "a/top.bin": 10, "a/.hidden": 5000}
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := New(root, config.HideRules{}, nil)
+	f.Sizes = NewSizes(f, time.Hour)
+
+	n, err := f.Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Usage == nil || !n.Usage.Pending {
+		t.Fatalf("expected the first usage to be pending, got %+v", n.Usage)
+	}
+
+	f.Sizes.Wait(root)
+	n, err = f.Read(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Usage{Size: 1110, Files: 3, Dirs: 2}
+	if *n.Usage != want {
+		t.Errorf("expected the usage of a to be %+v, got %+v", want, *n.Usage)
+	}
+	if u := *n.Dirs[0].Usage; u != (Usage{Size: 1100, Files: 2, Dirs: 1}) {
+		t.Errorf("expected the usage of the child b, got %+v", u)
+	}
+
+	dir := filepath.Join(root, "a", "b", "c")
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.bin"), make([]byte, 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(dir)
+	if u := f.Sizes.Get(dir, info.ModTime()); !u.Pending || u.Size != 1000 {
+		t.Errorf("expected the outdated usage while computing, got %+v", u)
+	}
+	f.Sizes.Wait(dir)
+	if u := f.Sizes.Get(dir, info.ModTime()); u.Pending || u.Size != 1001 {
+		t.Errorf("expected the new usage, got %+v", u)
+	}
+}
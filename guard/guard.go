@@ -0,0 +1,174 @@
+// Package guard tracks failed attempts by key, like a client address or a path, and locks keys out
+// for exponentially growing durations once they fail too often.
+package guard
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy defines when and for how long keys get locked out.
+type Policy struct {
+	// Attempts is the number of failures allowed before a key gets locked out. 0 disables the lockouts.
+	Attempts int
+	// Lockout is the duration of the first lockout, doubled by every further failure.
+	Lockout time.Duration
+	// MaxLockout caps the duration of a lockout.
+	MaxLockout time.Duration
+	// ResetAfter is how long after its last failure a key's failures are forgotten.
+	ResetAfter time.Duration
+}
+
+// lockout returns the lockout duration after the failure number n.
+func (p Policy) lockout(n int) time.Duration {
+	if p.Attempts <= 0 || n < p.Attempts {
+		return 0
+	}
+	d := p.Lockout
+	for i := p.Attempts; i < n && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if p.MaxLockout > 0 && d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+// Status is the state of a tracked key.
+type Status struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+}
+
+// Locked returns whether the key is locked out at the time now.
+func (s Status) Locked(now time.Time) bool {
+	return now.Before(s.LockedUntil)
+}
+
+// Guard tracks the failures of keys, safe for concurrent use.
+type Guard struct {
+	mu     sync.Mutex
+	policy Policy
+	keys   map[string]*Status
+	now    func() time.Time
+}
+
+// New returns a Guard enforcing the policy p.
+func New(p Policy) *Guard {
+	return &Guard{policy: p, keys: make(map[string]*Status), now: time.Now}
+}
+
+// SetPolicy replaces the policy, keeping the tracked failures.
+func (g *Guard) SetPolicy(p Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = p
+}
+
+// status returns the current status of key, forgetting it if it expired. g.mu must be held.
+func (g *Guard) status(key string, now time.Time) *Status {
+	s, ok := g.keys[key]
+	if !ok {
+		return nil
+	}
+	if g.policy.ResetAfter > 0 && now.Sub(s.LastFailure) > g.policy.ResetAfter && !s.Locked(now) {
+		delete(g.keys, key)
+		return nil
+	}
+	return s
+}
+
+// Check returns how long until the first locked out key of keys can try again, or 0 if none is locked out.
+func (g *Guard) Check(keys ...string) time.Duration {
+	if g == nil {
+		return 0
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	var wait time.Duration
+	for _, key := range keys {
+		if s := g.status(key, now); s != nil && s.Locked(now) {
+			if d := s.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Fail records a failure for all keys, locking them out if needed.
+func (g *Guard) Fail(keys ...string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for _, key := range keys {
+		s := g.status(key, now)
+		if s == nil {
+			s = &Status{Key: key}
+			g.keys[key] = s
+		}
+		s.Failures++
+		s.LastFailure = now
+		if d := g.policy.lockout(s.Failures); d > 0 {
+			s.LockedUntil = now.Add(d)
+		}
+	}
+	g.prune(now)
+}
+
+// Succeed forgets the failures of all keys.
+func (g *Guard) Succeed(keys ...string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range keys {
+		delete(g.keys, key)
+	}
+}
+
+// prune forgets the expired keys. g.mu must be held.
+func (g *Guard) prune(now time.Time) {
+	for key := range g.keys {
+		g.status(key, now)
+	}
+}
+
+// Snapshot returns the status of all tracked keys, locked out ones first, then by key.
+func (g *Guard) Snapshot() []Status {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.prune(now)
+	statuses := make([]Status, 0, len(g.keys))
+	for _, s := range g.keys {
+		statuses = append(statuses, *s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		li, lj := statuses[i].Locked(now), statuses[j].Locked(now)
+		if li != lj {
+			return li
+		}
+		return statuses[i].Key < statuses[j].Key
+	})
+	return statuses
+}
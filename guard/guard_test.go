@@ -0,0 +1,48 @@
+package guard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := New(Policy{Attempts: 3, Lockout: time.Minute, MaxLockout: 3 * time.Minute, ResetAfter: time.Hour})
+	g.now = func() time.Time { return now }
+
+	g.Fail("ip:192.0.2.1")
+	g.Fail("ip:192.0.2.1")
+	if d := g.Check("ip:192.0.2.1"); d != 0 {
+		t.Fatalf("expected no lockout before the threshold, got %s", d)
+	}
+
+	tests := []struct {
+		name     string
+		expected time.Duration
+	}{
+		{"first lockout", time.Minute},
+		{"doubled", 2 * time.Minute},
+		{"capped", 3 * time.Minute},
+	}
+	for _, test := range tests {
+		g.Fail("ip:192.0.2.1")
+		if d := g.Check("ip:192.0.2.1", "path:/secret"); d != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, d)
+		}
+	}
+
+	if s := g.Snapshot(); len(s) != 1 || s[0].Failures != 5 || !s[0].Locked(now) {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if d := g.Check("ip:192.0.2.1"); d != 0 || len(g.Snapshot()) != 0 {
+		t.Errorf("expected failures to be forgotten, got %s", d)
+	}
+
+	g.Fail("ip:192.0.2.2")
+	g.Succeed("ip:192.0.2.2")
+	if len(g.Snapshot()) != 0 {
+		t.Error("expected success to forget the failures")
+	}
+}
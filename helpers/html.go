@@ -4,50 +4,119 @@ import (
 	"filekeep/config"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
-// StripRoot will strip the root path from the config from the provided path.
+// StripRoot will strip the root path from the config from the provided path, or the path of its mount.
 func StripRoot(path string) string {
-	root := config.Get().Root
+	c := config.Get()
+	return TrimMounts(c.Root, c.Mounts, path)
+}
+
+// TrimRoot will strip the root path from the provided path.
+func TrimRoot(root, path string) string {
 	if strings.HasSuffix(root, string(os.PathSeparator)) {
 		root = strings.TrimRight(root, string(os.PathSeparator))
 	}
-	if root != "." {
+	if root == "." {
+		return path
+	}
+	if path == root {
+		return ""
+	}
+	if root == "" || strings.HasPrefix(path, root+string(os.PathSeparator)) {
 		return strings.TrimPrefix(path, root)
 	}
 	return path
 }
 
+// TrimMounts will strip the root path from the provided path like TrimRoot, or the path of the mount
+// holding it, replaced by the name of the mount.
+func TrimMounts(root string, mounts []config.Mount, path string) string {
+	for _, m := range mounts {
+		mountPath := filepath.Clean(m.Path)
+		if path == mountPath || strings.HasPrefix(path, mountPath+string(os.PathSeparator)) {
+			path = filepath.Join(root, m.Name, strings.TrimPrefix(path, mountPath))
+			break
+		}
+	}
+	return TrimRoot(root, path)
+}
+
 // Breadcrumb is a struct for a bread crumb containing a path and a name.
 type Breadcrumb struct {
 	Path string
 	Name string
 }
 
+// Links builds the URLs of the paths under Root, for a server mounted at Prefix.
+type Links struct {
+	// Root is the root directory, stripped from the paths.
+	Root string
+	// Mounts are the directories mounted in the root, their paths replaced by their names.
+	Mounts []config.Mount
+	// Prefix is the URL path the server is mounted at, e.g. "/files". Empty means "/".
+	Prefix string
+}
+
+// CleanPrefix returns prefix as an absolute URL path without a trailing slash, or "" for the root.
+func CleanPrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	prefix = path.Clean("/" + prefix)
+	if prefix == "/" {
+		return ""
+	}
+	return prefix
+}
+
+// Under returns the links of a view mounted at the path under the prefix, e.g. "_du".
+func (l Links) Under(path string) Links {
+	l.Prefix = CleanPrefix(l.Prefix) + CleanPrefix(path)
+	return l
+}
+
+// Breadcrumbs returns a slice of Breadcrumb from a string, by splitting with a separator.
+func Breadcrumbs(text, separator string) []Breadcrumb {
+	c := config.Get()
+	return Links{Root: c.Root, Mounts: c.Mounts}.Breadcrumbs(text, separator)
+}
+
 // Breadcrumbs returns a slice of Breadcrumb from a string, by splitting with a separator.
-func Breadcrumbs(text, separator string) (b []Breadcrumb) {
+func (l Links) Breadcrumbs(text, separator string) (b []Breadcrumb) {
 	if separator == "" {
 		separator = string(os.PathSeparator)
 	}
-	text = StripRoot(text)
-	b = append(b, Breadcrumb{"/", "~"})
+	prefix := CleanPrefix(l.Prefix)
+	text = TrimMounts(l.Root, l.Mounts, text)
+	b = append(b, Breadcrumb{prefix + "/", "~"})
 	split := strings.Split(text, separator)
 	var path string
 	for _, v := range split {
 		if v == "" || v == "." {
 			continue
 		}
-		path += Href(v)
-		b = append(b, Breadcrumb{path, v})
+		path += href(v)
+		b = append(b, Breadcrumb{prefix + path, v})
 	}
 	return
 }
 
 // Href returns the URL address for a path by stripping the root dir
 func Href(path string) string {
-	path = StripRoot(path)
+	c := config.Get()
+	return Links{Root: c.Root, Mounts: c.Mounts}.Href(path)
+}
+
+// Href returns the URL address for a path by stripping the root dir and prepending the prefix.
+func (l Links) Href(path string) string {
+	return CleanPrefix(l.Prefix) + href(TrimMounts(l.Root, l.Mounts, path))
+}
+
+func href(path string) string {
 	if len(path) == 0 || path == "." {
 		return "/"
 	}
@@ -57,7 +126,11 @@ func Href(path string) string {
 	}
 
 	path = strings.Replace(path, `\`, `/`, -1)
-	path = url.PathEscape(path)
+	segments := strings.Split(path, "/")
+	for i, v := range segments {
+		segments[i] = url.PathEscape(v)
+	}
+	path = strings.Join(segments, "/")
 
 	if filepath.IsAbs(path) {
 		return path
@@ -64,3 +64,40 @@ func TestHref(t *testing.T) {
 
 	config.Get().Root = oldRoot
 }
+
+func TestLinks(t *testing.T) {
+	l := Links{Root: "/var/www", Prefix: "/files/"}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"root", "/var/www", "/files/"},
+		{"relative", "foo/bar", "/files/foo/bar"},
+		{"stripped", "/var/www/foo bar", "/files/foo%20bar"},
+		{"sibling of root", "/var/wwwfoo", "/files/var/wwwfoo"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if l.Href(test.path) != test.expected {
+				t.Error(test.name, test.expected, l.Href(test.path))
+			}
+		})
+	}
+
+	b := l.Breadcrumbs("/var/www/foo/bar", "/")
+	expected := []Breadcrumb{{"/files/", "~"}, {"/files/foo", "foo"}, {"/files/foo/bar", "bar"}}
+	if len(b) != len(expected) {
+		t.Fatal(b)
+	}
+	for i := range b {
+		if b[i] != expected[i] {
+			t.Error(b[i], expected[i])
+		}
+	}
+
+	if href := l.Under("_du").Href("/var/www/foo"); href != "/files/_du/foo" {
+		t.Error("under", href)
+	}
+}
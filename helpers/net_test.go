@@ -0,0 +1,70 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseNets([]string{"10.0.0.0/8", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		expected  string
+	}{
+		{"direct", "203.0.113.1:1234", "", "203.0.113.1"},
+		{"untrusted proxy", "203.0.113.1:1234", "198.51.100.7", "203.0.113.1"},
+		{"trusted proxy", "127.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"proxy chain", "127.0.0.1:1234", "192.0.2.9, 198.51.100.7, 10.1.2.3", "198.51.100.7"},
+		{"only proxies", "127.0.0.1:1234", "10.1.2.3", "10.1.2.3"},
+		{"garbage", "127.0.0.1:1234", "nope", "127.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remote
+			if test.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+			if ip := ClientIP(r, trusted); ip != test.expected {
+				t.Error(test.name, test.expected, ip)
+			}
+		})
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	trusted, err := ParseNets([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		remote   string
+		proto    string
+		host     string
+		expected string
+	}{
+		{"direct", "203.0.113.1:1234", "", "", "http://example.com"},
+		{"untrusted proxy", "203.0.113.1:1234", "https", "evil.example", "http://example.com"},
+		{"trusted proxy", "127.0.0.1:1234", "https", "files.example.com, other", "https://files.example.com"},
+		{"garbage", "127.0.0.1:1234", "javascript", "", "http://example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/", nil)
+			r.RemoteAddr = test.remote
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+			r.Header.Set("X-Forwarded-Host", test.host)
+			if u := BaseURL(r, trusted); u != test.expected {
+				t.Error(test.name, test.expected, u)
+			}
+		})
+	}
+}
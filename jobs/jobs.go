@@ -0,0 +1,215 @@
+// Package jobs runs long operations in the background, a few at a time, and keeps track of their progress
+// so clients can poll it.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for unknown or forgotten jobs.
+var ErrNotFound = errors.New("job not found")
+
+// The states of a job.
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Done      = "done"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+// Status is a snapshot of a job.
+type Status struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	State  string `json:"state"`
+	Error  string `json:"error,omitempty"`
+	Result string `json:"result,omitempty"`
+	// Bytes and Files are the work done so far, out of TotalBytes and TotalFiles, if known.
+	Bytes      int64     `json:"bytes"`
+	TotalBytes int64     `json:"total_bytes"`
+	Files      int       `json:"files"`
+	TotalFiles int       `json:"total_files"`
+	Created    time.Time `json:"created"`
+	Started    time.Time `json:"started,omitempty"`
+	Finished   time.Time `json:"finished,omitempty"`
+}
+
+// Ended returns whether the job won't change anymore.
+func (s Status) Ended() bool {
+	return s.State == Done || s.State == Failed || s.State == Cancelled
+}
+
+// Job is a background operation, which reports its progress through its methods. Safe for concurrent use.
+type Job struct {
+	mu     sync.Mutex
+	status Status
+	cancel context.CancelFunc
+}
+
+// SetTotal sets the total work of the job, in bytes and files.
+func (j *Job) SetTotal(bytes int64, files int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.TotalBytes, j.status.TotalFiles = bytes, files
+}
+
+// Add adds the work done to the progress of the job.
+func (j *Job) Add(bytes int64, files int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Bytes += bytes
+	j.status.Files += files
+}
+
+// Status returns a snapshot of the job.
+func (j *Job) Status() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+func (j *Job) set(f func(s *Status)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f(&j.status)
+}
+
+// Func is the work of a job, returning the result, like the path of the file it created.
+// It should stop early when ctx is done.
+type Func func(ctx context.Context, j *Job) (string, error)
+
+// Manager runs jobs, at most Workers at a time, and forgets them Keep after they end.
+// Safe for concurrent use.
+type Manager struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	scopes map[string]*Manager
+	sem    chan struct{}
+	keep   time.Duration
+	now    func() time.Time
+}
+
+// New returns a Manager running up to workers jobs at a time, remembering them for keep after they end.
+func New(workers int, keep time.Duration) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Manager{
+		jobs: make(map[string]*Job),
+		sem:  make(chan struct{}, workers),
+		keep: keep,
+		now:  time.Now,
+	}
+}
+
+// Scope returns the manager of the jobs of the scope name, like a site, which shares the workers of m but
+// only lists, gets and cancels its own jobs. It's the same manager for the same name.
+func (m *Manager) Scope(name string) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scopes == nil {
+		m.scopes = make(map[string]*Manager)
+	}
+	scope, ok := m.scopes[name]
+	if !ok {
+		scope = &Manager{jobs: make(map[string]*Job), sem: m.sem, keep: m.keep, now: m.now}
+		m.scopes[name] = scope
+	}
+	return scope
+}
+
+// Start queues the job of type typ doing f, and returns it.
+func (m *Manager) Start(typ string, f Func) *Job {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{cancel: cancel, status: Status{ID: hex.EncodeToString(id), Type: typ, State: Queued, Created: m.now()}}
+
+	m.mu.Lock()
+	m.prune()
+	m.jobs[j.status.ID] = j
+	m.mu.Unlock()
+
+	go m.run(ctx, j, f)
+	return j
+}
+
+func (m *Manager) run(ctx context.Context, j *Job, f Func) {
+	defer j.cancel()
+
+	select {
+	case m.sem <- struct{}{}:
+		defer func() { <-m.sem }()
+	case <-ctx.Done():
+		j.set(func(s *Status) { s.State, s.Finished = Cancelled, m.now() })
+		return
+	}
+
+	j.set(func(s *Status) { s.State, s.Started = Running, m.now() })
+	result, err := f(ctx, j)
+	j.set(func(s *Status) {
+		s.Finished = m.now()
+		switch {
+		case ctx.Err() != nil:
+			s.State = Cancelled
+		case err != nil:
+			s.State, s.Error = Failed, err.Error()
+		default:
+			s.State, s.Result = Done, result
+		}
+	})
+}
+
+// Get returns the job with the id.
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return j, nil
+}
+
+// Cancel stops the job with the id, if it's still queued or running.
+func (m *Manager) Cancel(id string) (*Job, error) {
+	j, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	j.cancel()
+	return j, nil
+}
+
+// List returns the snapshots of the jobs, the newest first.
+func (m *Manager) List() []Status {
+	m.mu.Lock()
+	m.prune()
+	list := make([]Status, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		list = append(list, j.Status())
+	}
+	m.mu.Unlock()
+
+	sort.Slice(list, func(i, k int) bool { return list[i].Created.After(list[k].Created) })
+	return list
+}
+
+// prune forgets the jobs which ended longer than keep ago. The caller holds mu.
+func (m *Manager) prune() {
+	now := m.now()
+	for id, j := range m.jobs {
+		if s := j.Status(); s.Ended() && now.Sub(s.Finished) > m.keep {
+			delete(m.jobs, id)
+		}
+	}
+}
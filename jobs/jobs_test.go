@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func wait(t *testing.T, j *Job) Status {
+	for i := 0; i < 200; i++ {
+		if s := j.Status(); s.Ended() {
+			return s
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't end", j.Status().ID)
+	return Status{}
+}
+
+func TestManager(t *testing.T) {
+	m := New(1, time.Hour)
+
+	block, started := make(chan struct{}), make(chan struct{})
+	first := m.Start("test", func(ctx context.Context, j *Job) (string, error) {
+		j.SetTotal(10, 1)
+		j.Add(5, 0)
+		close(started)
+		<-block
+		return "result", nil
+	})
+	<-started
+	queued := m.Start("test", func(ctx context.Context, j *Job) (string, error) {
+		return "", errors.New("shouldn't run")
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	if s := first.Status(); s.State != Running || s.Bytes != 5 || s.TotalBytes != 10 {
+		t.Errorf("expected the first job to be running with its progress, got %+v", s)
+	}
+	if s := queued.Status(); s.State != Queued {
+		t.Errorf("expected the second job to wait for the worker, got %+v", s)
+	}
+
+	if _, err := m.Cancel(queued.Status().ID); err != nil {
+		t.Fatal(err)
+	}
+	close(block)
+	if s := wait(t, first); s.State != Done || s.Result != "result" {
+		t.Errorf("expected the first job to be done, got %+v", s)
+	}
+	if s := wait(t, queued); s.State != Cancelled {
+		t.Errorf("expected the second job to be cancelled, got %+v", s)
+	}
+
+	failed := m.Start("test", func(ctx context.Context, j *Job) (string, error) {
+		return "", errors.New("broken")
+	})
+	if s := wait(t, failed); s.State != Failed || s.Error != "broken" {
+		t.Errorf("expected the job to fail, got %+v", s)
+	}
+
+	if list := m.List(); len(list) != 3 || list[0].ID != failed.Status().ID {
+		t.Errorf("expected 3 jobs, the newest first, got %+v", list)
+	}
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := m.Get(first.Status().ID); err != ErrNotFound {
+		t.Errorf("expected ended jobs to be forgotten, got %v", err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	m := New(1, time.Hour)
+	a, b := m.Scope("a"), m.Scope("b")
+	if m.Scope("a") != a {
+		t.Error("expected the same manager for the same scope")
+	}
+
+	j := a.Start("test", func(ctx context.Context, j *Job) (string, error) {
+		return "result", nil
+	})
+	wait(t, j)
+	if _, err := b.Get(j.Status().ID); err != ErrNotFound {
+		t.Errorf("expected the job to be unknown to the other scope, got %v", err)
+	}
+	if _, err := b.Cancel(j.Status().ID); err != ErrNotFound {
+		t.Errorf("expected the job not to be cancelled by the other scope, got %v", err)
+	}
+	if len(b.List()) != 0 || len(m.List()) != 0 || len(a.List()) != 1 {
+		t.Errorf("expected the job to be listed by its scope only, got %v, %v, %v", a.List(), b.List(), m.List())
+	}
+}
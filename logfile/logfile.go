@@ -0,0 +1,244 @@
+// Package logfile implements a log file rotated by size and age, which can be reopened
+// after being moved by external tools.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupFormat is the time format appended to the names of rotated files, followed by "-1", "-2" and so on
+// if a file with the same time exists already.
+const backupFormat = "20060102-150405.000000"
+
+// File is an append-only log file, safe for concurrent use.
+type File struct {
+	// Path is the path of the file on disk.
+	Path string
+	// MaxSize is the size in bytes after which the file gets rotated. 0 disables rotation by size.
+	MaxSize int64
+	// MaxAge is the age after which the file gets rotated. 0 disables rotation by age.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept. 0 keeps all of them.
+	MaxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+	size   int64
+	// created is when the file was last rotated, or first opened if it never was
+	created time.Time
+}
+
+// Open opens the file at path for appending, creating it if needed.
+func Open(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*File, error) {
+	f := &File{Path: path, MaxSize: maxSize, MaxAge: maxAge, MaxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	fd, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't open log file: %s", err)
+	}
+
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("couldn't stat log file: %s", err)
+	}
+
+	f.f = fd
+	f.size = info.Size()
+	// the modification time is the last write, only a rotation tells when the file was started
+	f.created = time.Now()
+	if rotated := f.backups(); f.size > 0 && len(rotated) > 0 {
+		f.created, _, _ = parseBackup(f.Path, rotated[len(rotated)-1])
+	}
+	return nil
+}
+
+// Write appends p to the file, rotating it first if it grew too big or too old. If the file couldn't be
+// rotated, p is still appended to it, and the error returned.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.f == nil {
+		// a previous rotation or reopening failed, try again
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	var rotateErr error
+	if f.size > 0 && f.shouldRotate(int64(len(p))) {
+		rotateErr = f.rotate()
+		if f.f == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (f *File) shouldRotate(n int64) bool {
+	if f.MaxSize > 0 && f.size+n > f.MaxSize {
+		return true
+	}
+	return f.MaxAge > 0 && time.Since(f.created) > f.MaxAge
+}
+
+// rotate renames the current file with a timestamp suffix, and opens a new one. If the file can't be
+// renamed, it's opened again to go on appending to it. f.mu must be held.
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("couldn't close log file: %s", err)
+	}
+	f.f = nil
+
+	now := time.Now()
+	if err := os.Rename(f.Path, f.backupName(now)); err != nil {
+		if reopenErr := f.open(); reopenErr != nil {
+			return fmt.Errorf("couldn't rotate log file: %s, nor reopen it: %s", err, reopenErr)
+		}
+		return fmt.Errorf("couldn't rotate log file: %s", err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.created = now
+	return f.prune()
+}
+
+// backupName returns the name of the file rotated at t, which doesn't exist yet.
+func (f *File) backupName(t time.Time) string {
+	name := f.Path + "." + t.Format(backupFormat)
+	backup := name
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			return backup
+		}
+		backup = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// parseBackup returns the time the backup of the file at path was rotated and its counter, and whether it's
+// one of its backups.
+func parseBackup(path, backup string) (time.Time, int, bool) {
+	suffix := strings.TrimPrefix(backup, path+".")
+	if len(suffix) == len(backup) || len(suffix) < len(backupFormat) {
+		return time.Time{}, 0, false
+	}
+	t, err := time.ParseInLocation(backupFormat, suffix[:len(backupFormat)], time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	var n int
+	if counter := suffix[len(backupFormat):]; counter != "" {
+		if n, err = strconv.Atoi(strings.TrimPrefix(counter, "-")); err != nil || counter[0] != '-' || n < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return t, n, true
+}
+
+// backups returns the rotated files, the oldest first.
+func (f *File) backups() []string {
+	matches, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return nil
+	}
+
+	type backup struct {
+		name string
+		t    time.Time
+		n    int
+	}
+	var found []backup
+	for _, name := range matches {
+		if t, n, ok := parseBackup(f.Path, name); ok {
+			found = append(found, backup{name, t, n})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].t.Equal(found[j].t) {
+			return found[i].t.Before(found[j].t)
+		}
+		return found[i].n < found[j].n
+	})
+
+	rotated := make([]string, len(found))
+	for i, b := range found {
+		rotated[i] = b.name
+	}
+	return rotated
+}
+
+// prune removes the oldest rotated files over MaxBackups.
+func (f *File) prune() error {
+	if f.MaxBackups <= 0 {
+		return nil
+	}
+
+	rotated := f.backups()
+	if len(rotated) <= f.MaxBackups {
+		return nil
+	}
+
+	for _, b := range rotated[:len(rotated)-f.MaxBackups] {
+		if err := os.Remove(b); err != nil {
+			return fmt.Errorf("couldn't remove old log file: %s", err)
+		}
+	}
+	return nil
+}
+
+// Reopen closes and reopens the file, to be called after it was moved by external tools like logrotate.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.f != nil {
+		if err := f.f.Close(); err != nil {
+			return fmt.Errorf("couldn't close log file: %s", err)
+		}
+		f.f = nil
+	}
+	return f.open()
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
@@ -0,0 +1,144 @@
+package logfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := Open(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"12345\n", "67890\n", "abcde\n", "fghij\n", "klmno\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "klmno\n" {
+		t.Errorf("expected the current file to hold the last line, got %q", b)
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Errorf("expected 2 backups to be kept, got %v", backups)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := Open(path, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before\n"))
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "after\n" {
+		t.Errorf("expected the reopened file to hold the new line, got %q", b)
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := Open(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("12345\n"))
+	// the file can't be renamed once it's gone
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("67890\n")); n != 6 || err == nil {
+		t.Errorf("expected the line to be written with the rotation error, got %d, %v", n, err)
+	}
+	if _, err := f.Write([]byte("abcde\n")); err != nil {
+		t.Errorf("expected the file to be logged to after a failed rotation, got %v", err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "67890\n" && string(b) != "abcde\n" {
+		t.Errorf("expected the file to be reopened, got %q", b)
+	}
+}
+
+func TestBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	rotated := time.Now().Add(-2 * time.Hour)
+	name := path + "." + rotated.Format(backupFormat)
+	for _, backup := range []string{name, name + "-10", name + "-2"} {
+		if err := ioutil.WriteFile(backup, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path, []byte("current\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if backups := f.backups(); len(backups) != 3 || backups[1] != name+"-2" || backups[2] != name+"-10" {
+		t.Errorf("expected the backups in order, got %v", backups)
+	}
+	if backup := f.backupName(rotated); backup != name+"-1" {
+		t.Errorf("expected a free backup name, got %q", backup)
+	}
+
+	// the file was started by the last rotation, two hours ago
+	f.Write([]byte("new\n"))
+	if b, _ := ioutil.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("expected the file to be rotated by age, got %q", b)
+	}
+}
@@ -2,51 +2,238 @@ package main
 
 import (
 	"filekeep/config"
-	"filekeep/web"
 	"flag"
+	"fmt"
 	"os"
+	"sort"
 
 	"github.com/sirupsen/logrus"
 )
 
+// The exit codes of the commands.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	// exitUsage is returned for wrong commands, flags or arguments.
+	exitUsage = 2
+)
+
+// command is a subcommand of the binary, run with the arguments following its name.
+type command struct {
+	run   func(args []string) int
+	usage string
+}
+
+// commands are the subcommands, serve being the default one.
+var commands = map[string]command{
+	"serve":  {serveCommand, "serve the files, the default command"},
+	"config": {configCommand, "dump, validate or show the config, or list its options"},
+	"passwd": {passwdCommand, "set or remove the password of a file or directory"},
+	"check":  {checkCommand, "diagnose the config and the environment"},
+	"audit":  {auditCommand, "search the audit log, or verify its hash chain"},
+	"export": {exportCommand, "write a static mirror of the listings and files"},
+}
+
 var (
-	dumpConfig = flag.Bool("dump-config", false, "dump the default config to disk")
+	dumpConfig = new(dumpFlag)
 	configFlag = flag.String("config", "", "path to the config file")
 )
 
+func init() {
+	flag.Var(dumpConfig, "dump-config", "dump the config in use to `path`, "+exampleConfig+" without one and - for stdout, like the config dump command")
+}
+
+// exampleConfig is where the config is dumped by default.
+const exampleConfig = "config.example.yaml"
+
+// dumpFlag is the path of the legacy -dump-config flag, which may be given without one.
+type dumpFlag struct {
+	path string
+}
+
+func (f *dumpFlag) String() string {
+	return f.path
+}
+
+func (f *dumpFlag) Set(v string) error {
+	switch v {
+	case "true":
+		f.path = exampleConfig
+	case "false":
+		f.path = ""
+	default:
+		f.path = v
+	}
+	return nil
+}
+
+func (f *dumpFlag) IsBoolFlag() bool {
+	return true
+}
+
+// flagOverrides are the options set by flags, in the order given.
+var flagOverrides []config.Override
+
+// optionFlag is the flag setting a config option, named after it.
+type optionFlag struct {
+	option config.Option
+}
+
+func (f optionFlag) String() string {
+	return ""
+}
+
+// Set checks the value against the defaults, for wrong values to be reported like wrong flags,
+// and records it to be set over the config file.
+func (f optionFlag) Set(v string) error {
+	if err := config.Defaults().Set(f.option.Name, v); err != nil {
+		return err
+	}
+	flagOverrides = append(flagOverrides, config.Override{Option: f.option.Name, Value: v, Source: "-" + f.option.Name})
+	return nil
+}
+
+func (f optionFlag) IsBoolFlag() bool {
+	return f.option.Bool
+}
+
 var c = config.Get()
 
-func init() {
+func main() {
+	flag.Usage = usage
+	addOptionFlags(flag.CommandLine)
 	flag.Parse()
+	os.Exit(run(flag.Args()))
+}
 
-	if *dumpConfig {
-		if err := config.Dump(); err != nil {
-			logrus.WithError(err).Error("couldn't dump default config")
-			os.Exit(1)
-		}
-		os.Exit(0)
+// run runs the command named by the first of args, and returns its exit code.
+func run(args []string) int {
+	if dumpConfig.path != "" {
+		return configCommand([]string{"dump", "-out", dumpConfig.path})
+	}
+
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		logrus.Errorf("unknown command %q", name)
+		flag.Usage()
+		return exitUsage
 	}
+	return cmd.run(args)
+}
 
-	if *configFlag != "" {
-		var err error
-		c, err = config.Load(*configFlag)
-		if err != nil {
-			logrus.WithError(err).Error("couldn't load config")
-			os.Exit(1)
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: filekeep [-config path] [command] [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-8s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(out, "\nRun filekeep <command> -h for the flags of a command.\n\nFlags:\n")
+	printFlags(flag.CommandLine)
+}
+
+// addOptionFlags adds a flag for every config option to flags, like -web.port.
+func addOptionFlags(flags *flag.FlagSet) {
+	for _, o := range config.Options() {
+		flags.Var(optionFlag{o}, o.Name, "set the "+o.Name+" option, like "+o.Env)
+	}
+}
+
+// printFlags prints the defaults of the flags, leaving the config options out for brevity.
+func printFlags(flags *flag.FlagSet) {
+	shown := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+	shown.SetOutput(flags.Output())
+	flags.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(optionFlag); !ok {
+			shown.Var(f.Value, f.Name, f.Usage)
 		}
+	})
+	shown.PrintDefaults()
+	fmt.Fprintf(flags.Output(), "\nEvery config option can also be set by a flag named after it, like -web.port 9000,\n"+
+		"or by an environment variable, like %sWEB_PORT=9000. Run filekeep config options to list them.\n", config.EnvPrefix)
+}
+
+// newFlagSet returns the flags of the command name, which also accept -config and the config options
+// like the global flags.
+// Wrong flags exit with exitUsage.
+func newFlagSet(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(configFlag, "config", *configFlag, "path to the config file")
+	addOptionFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: filekeep %s %s\n\nFlags:\n", name, args)
+		printFlags(flags)
+	}
+	return flags
+}
+
+// parseFlags parses args, letting the flags follow the first n arguments too, as in
+// "passwd set docs/a.txt -password 1234", and returns the arguments.
+func parseFlags(flags *flag.FlagSet, args []string, n int) []string {
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) > n {
+		flags.Parse(args[n:])
+		args = append(args[:n:n], flags.Args()...)
+	}
+	return args
+}
+
+// loadConfig loads the config file given with -config into c, if any, with the options set by the
+// environment and the flags over it, and sets the log level. The mistakes of the config are returned
+// as config.Problems.
+func loadConfig() error {
+	var err error
+	if c, err = config.Load(*configFlag, overrides()...); err != nil {
+		return err
 	}
 
 	if c.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 		logrus.Debug("debugging active")
 	}
+	return nil
 }
 
-func main() {
-	server := web.NewServer()
-	logrus.WithField("address", c.Web.String()).Info("starting server")
-	if err := server.ListenAndServe(); err != nil {
-		logrus.WithError(err).Error("error while serving the web server")
-		os.Exit(1)
+// overrides returns the options set over the config file, by the environment and then by the flags,
+// the flags winning.
+func overrides() []config.Override {
+	return append(config.Env(os.Environ()), flagOverrides...)
+}
+
+// logConfigError logs the error of loadConfig, every mistake of the config on its own.
+func logConfigError(err error) {
+	problems, ok := err.(config.Problems)
+	if !ok {
+		logrus.WithError(err).Error("couldn't load config")
+		return
 	}
+	file := *configFlag
+	if file == "" {
+		file = "default config"
+	}
+	for _, p := range problems {
+		if p.Source != "" {
+			logrus.Error(p)
+		} else {
+			logrus.Errorf("%s: %s", file, p)
+		}
+	}
+}
+
+// isSet returns whether the flag name was given.
+func isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
 }
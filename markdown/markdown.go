@@ -0,0 +1,81 @@
+// Package markdown renders Markdown documents to HTML safe to embed in a page. They're rendered by goldmark
+// as CommonMark with GitHub's extensions, then sanitized by bluemonday, which only keeps the elements and
+// attributes of user generated content, and links to http, https and mailto URLs, or relative ones.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	schemeRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+	// baseKey holds the base URL of the document in the parser context.
+	baseKey = parser.NewContextKey()
+
+	md = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(parser.WithASTTransformers(util.Prioritized(resolver{}, 100))),
+	)
+	policy = newPolicy()
+)
+
+// newPolicy returns the policy sanitizing the rendered HTML. The documents are the site's own, so their links
+// are followed, and the language of code blocks is kept for syntax highlighting.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(false)
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	return p
+}
+
+// Render returns the HTML of the Markdown src. Relative links and images are resolved against base,
+// the URL of the directory holding the document, ending with a slash.
+func Render(src []byte, base string) template.HTML {
+	ctx := parser.NewContext()
+	ctx.Set(baseKey, base)
+	var buf bytes.Buffer
+	if err := md.Convert(src, &buf, parser.WithContext(ctx)); err != nil {
+		return template.HTML("<pre>" + template.HTMLEscapeString(string(src)) + "</pre>")
+	}
+	return template.HTML(policy.SanitizeBytes(buf.Bytes()))
+}
+
+// resolver resolves the relative destinations of links and images against the base URL of the document.
+type resolver struct{}
+
+func (resolver) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	base, _ := pc.Get(baseKey).(string)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			n.Destination = resolve(base, n.Destination)
+		case *ast.Image:
+			n.Destination = resolve(base, n.Destination)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// resolve returns the URL resolved against base, unless it's absolute or only a fragment or query.
+func resolve(base string, url []byte) []byte {
+	s := string(url)
+	if schemeRe.MatchString(s) || strings.HasPrefix(s, "/") || strings.HasPrefix(s, "#") || strings.HasPrefix(s, "?") {
+		return url
+	}
+	return []byte(base + s)
+}
@@ -0,0 +1,36 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := map[string]string{
+		"# Title #":                        "<h1>Title</h1>\n",
+		"some *em*, **strong** and `a<b`":  "<p>some <em>em</em>, <strong>strong</strong> and <code>a&lt;b</code></p>\n",
+		"snake_case_name and _em_":         "<p>snake_case_name and <em>em</em></p>\n",
+		"| a | b |\n|---|---|\n| 1 | 2 |":  "<table>\n<thead>\n<tr>\n<th>a</th>\n<th>b</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>1</td>\n<td>2</td>\n</tr>\n</tbody>\n</table>\n",
+		"- one\n- two\n  more\n\n1. first": "<ul>\n<li>one</li>\n<li>two\nmore</li>\n</ul>\n<ol>\n<li>first</li>\n</ol>\n",
+		"> quoted\n> text":                 "<blockquote>\n<p>quoted\ntext</p>\n</blockquote>\n",
+		"```go\nif a < b {}\n```":          "<pre><code class=\"language-go\">if a &lt; b {}\n</code></pre>\n",
+		"    indented\n\n---":              "<pre><code>indented\n</code></pre>\n<hr>\n",
+		"[docs](docs/a.md) [abs](/x) [web](https://example.com \"title\")": `<p><a href="/files/docs/a.md">docs</a> <a href="/x">abs</a> <a href="https://example.com" title="title">web</a></p>` + "\n",
+		"![logo](logo.png) <https://a.b/c>":                                `<p><img src="/files/logo.png" alt="logo"> <a href="https://a.b/c">https://a.b/c</a></p>` + "\n",
+	}
+	for src, want := range tests {
+		if got := string(Render([]byte(src), "/files/")); got != want {
+			t.Errorf("rendering %q:\nexpected %q\ngot      %q", src, want, got)
+		}
+	}
+}
+
+func TestRenderSanitizes(t *testing.T) {
+	src := "<script>alert(1)</script>\n\n[click](javascript:alert(1)) ![x](data:text/html,1) <b onclick=x>\n\n[a\"b](\"onmouseover=\"x)"
+	got := string(Render([]byte(src), "/"))
+	for _, s := range []string{"<script", "javascript:", "data:", "<b ", `"onmouseover`} {
+		if strings.Contains(got, s) {
+			t.Errorf("expected %q to be removed or escaped, got %q", s, got)
+		}
+	}
+}
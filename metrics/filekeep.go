@@ -0,0 +1,52 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// The metrics collected by filekeep.
+var (
+	// Requests counts the HTTP requests by route and status code.
+	Requests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "filekeep_http_requests_total",
+		Help: "HTTP requests by route and status code.",
+	}, []string{"route", "code"})
+	// RequestDuration observes the HTTP request latencies by route and status code.
+	RequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "filekeep_http_request_duration_seconds",
+		Help: "HTTP request latencies by route and status code.",
+	}, []string{"route", "code"})
+	// BytesServed counts the bytes written in HTTP response bodies, by route.
+	BytesServed = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "filekeep_http_response_bytes_total",
+		Help: "Bytes written in HTTP response bodies, by route.",
+	}, []string{"route"})
+	// ActiveDownloads is the number of file downloads in progress.
+	ActiveDownloads = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "filekeep_active_downloads",
+		Help: "File downloads in progress.",
+	})
+	// PasswordFailures counts the wrong passwords submitted for protected files and directories.
+	PasswordFailures = factory.NewCounter(prometheus.CounterOpts{
+		Name: "filekeep_password_failures_total",
+		Help: "Wrong passwords submitted for protected files and directories.",
+	})
+	// ListingDuration observes how long reading a directory listing takes.
+	ListingDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Name: "filekeep_listing_duration_seconds",
+		Help: "Time spent reading directory listings.",
+	})
+	// CacheRequests counts the cache lookups by cache name and result, hit or miss.
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "filekeep_cache_requests_total",
+		Help: "Cache lookups by cache name and result.",
+	}, []string{"cache", "result"})
+)
+
+// CacheHit records a hit in the named cache.
+func CacheHit(cache string) {
+	CacheRequests.WithLabelValues(cache, "hit").Inc()
+}
+
+// CacheMiss records a miss in the named cache.
+func CacheMiss(cache string) {
+	CacheRequests.WithLabelValues(cache, "miss").Inc()
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	CacheHit(`a"b`)
+	CacheMiss("list")
+	CacheMiss("list")
+	ListingDuration.Observe(0.5)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := []string{
+		`filekeep_cache_requests_total{cache="a\"b",result="hit"} 1`,
+		`filekeep_cache_requests_total{cache="list",result="miss"} 2`,
+		`filekeep_listing_duration_seconds_bucket{le="0.5"} 1`,
+		"filekeep_listing_duration_seconds_count 1",
+		"# TYPE go_goroutines gauge",
+	}
+	for _, line := range expected {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("expected output to contain %q, got:\n%s", line, w.Body.String())
+		}
+	}
+}
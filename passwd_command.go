@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"filekeep/fs"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// passwdCommand sets or removes the password of a file or directory under the root, and returns the exit code.
+func passwdCommand(args []string) int {
+	flags := newFlagSet("passwd", "set|remove [-password password] [-site host] path")
+	password := flags.String("password", "", "the password to set, read from the terminal or the standard input if empty")
+	site := flags.String("site", "", "host name of the site the path is in, instead of the root")
+	args = parseFlags(flags, args, 2)
+	if len(args) != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		logConfigError(err)
+		return exitFailure
+	}
+
+	root := fs.New(c.Root, c.HideRules, nil)
+	root.Mounts = c.Mounts
+	if *site != "" {
+		s, ok := c.Sites[*site]
+		if !ok {
+			logrus.Errorf("no site for %q in the config", *site)
+			return exitUsage
+		}
+		root = fs.New(s.Root, c.SiteRules(s), nil)
+		root.Mounts = s.Mounts
+	}
+	path := root.Join(args[1])
+	if path == root.Join("/") {
+		logrus.Error("the root directory can't be protected, protect the directories in it")
+		return exitUsage
+	}
+	log := logrus.WithField("path", path)
+
+	switch args[0] {
+	case "set":
+		if *password == "" {
+			var err error
+			if *password, err = readPassword(); err != nil {
+				logrus.WithError(err).Error("couldn't read password")
+				return exitFailure
+			}
+		}
+		if *password == "" {
+			logrus.Error("empty password")
+			return exitUsage
+		}
+		if err := fs.SetPassword(path, *password); err != nil {
+			log.WithError(err).Error("couldn't set password")
+			return exitFailure
+		}
+		log.Info("set password")
+	case "remove":
+		if err := fs.RemovePassword(path); err != nil {
+			log.WithError(err).Error("couldn't remove password")
+			return exitFailure
+		}
+		log.Info("removed password")
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// readPassword prompts for the password twice on a terminal, or reads its first line from the standard input.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	first, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Again: ")
+	second, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("the passwords don't match")
+	}
+	return string(first), nil
+}
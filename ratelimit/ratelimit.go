@@ -0,0 +1,285 @@
+// Package ratelimit implements token buckets, used to limit the rate of requests and to throttle
+// the bandwidth of responses.
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket, filled at a constant rate up to its burst size. Safe for concurrent use,
+// and a nil Bucket never limits.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewBucket returns a full bucket filled with rate tokens per second, holding at most burst tokens.
+// A burst below 1 defaults to the rate, rounded up. A rate of 0 or less disables the limit, and returns nil.
+func NewBucket(rate float64, burst int) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if burst < 1 {
+		b = math.Ceil(rate)
+	}
+	return &Bucket{rate: rate, burst: b, tokens: b, now: time.Now}
+}
+
+// Burst returns the number of tokens the bucket holds when full.
+func (b *Bucket) Burst() int {
+	if b == nil {
+		return math.MaxInt32
+	}
+	return int(b.burst)
+}
+
+// refill adds the tokens accumulated since the last call. b.mu must be held.
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// Allow takes a token if one is available. Otherwise, it returns how long until one is.
+func (b *Bucket) Allow() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, b.wait(1 - b.tokens)
+}
+
+// Reserve takes n tokens, even if they aren't available yet, and returns how long until they are.
+func (b *Bucket) Reserve(n int) time.Duration {
+	if b == nil || n <= 0 {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return b.wait(-b.tokens)
+}
+
+// wait returns the time needed to fill n tokens.
+func (b *Bucket) wait(n float64) time.Duration {
+	return time.Duration(math.Ceil(n / b.rate * float64(time.Second)))
+}
+
+// idle returns whether the bucket got full again at the time now. b.mu must be held.
+func (b *Bucket) idle(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// pruneEvery is how often Keyed forgets its idle buckets.
+const pruneEvery = time.Minute
+
+// Keyed holds a bucket per key, like a client address, all with the same rate and burst.
+// Safe for concurrent use, and a nil Keyed never limits.
+type Keyed struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*Bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewKeyed returns a Keyed whose buckets are filled with rate tokens per second, holding at most
+// burst tokens. A rate of 0 or less disables the limit, and returns nil.
+func NewKeyed(rate float64, burst int) *Keyed {
+	if rate <= 0 {
+		return nil
+	}
+	return &Keyed{rate: rate, burst: burst, buckets: make(map[string]*Bucket), now: time.Now}
+}
+
+// Get returns the bucket of key, creating it if needed.
+func (k *Keyed) Get(key string) *Bucket {
+	if k == nil {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	if now.Sub(k.lastPrune) > pruneEvery {
+		k.prune(now)
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		b.now = k.now
+		k.buckets[key] = b
+	}
+	return b
+}
+
+// prune forgets the buckets that are full again, as they're equal to new ones. k.mu must be held.
+func (k *Keyed) prune(now time.Time) {
+	for key, b := range k.buckets {
+		b.mu.Lock()
+		idle := b.idle(now)
+		b.mu.Unlock()
+		if idle {
+			delete(k.buckets, key)
+		}
+	}
+	k.lastPrune = now
+}
+
+// Len returns the number of tracked keys.
+func (k *Keyed) Len() int {
+	if k == nil {
+		return 0
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.buckets)
+}
+
+// Bandwidth caps the bytes per second of responses: overall, per client address, and per path prefix.
+// The zero value and a nil Bandwidth never limit.
+type Bandwidth struct {
+	// Global is shared by all responses.
+	Global *Bucket
+	// PerIP holds a bucket per client address.
+	PerIP *Keyed
+
+	prefixes []string
+	paths    map[string]*Bucket
+}
+
+// SetPath caps the bandwidth of all responses under the path prefix to rate bytes per second, shared
+// by all clients. Responses under several prefixes are only capped by the longest one.
+func (bw *Bandwidth) SetPath(prefix string, rate float64) {
+	b := NewBucket(rate, 0)
+	if b == nil {
+		return
+	}
+	if bw.paths == nil {
+		bw.paths = make(map[string]*Bucket)
+	}
+	prefix = "/" + strings.Trim(prefix, "/")
+	if _, ok := bw.paths[prefix]; !ok {
+		bw.prefixes = append(bw.prefixes, prefix)
+		sort.Slice(bw.prefixes, func(i, j int) bool { return len(bw.prefixes[i]) > len(bw.prefixes[j]) })
+	}
+	bw.paths[prefix] = b
+}
+
+// path returns the bucket of the longest prefix containing the URL path p, if any.
+func (bw *Bandwidth) path(p string) *Bucket {
+	for _, prefix := range bw.prefixes {
+		if prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return bw.paths[prefix]
+		}
+	}
+	return nil
+}
+
+// Buckets returns the buckets limiting a response to the client ip on the URL path p.
+func (bw *Bandwidth) Buckets(ip, p string) []*Bucket {
+	if bw == nil {
+		return nil
+	}
+
+	var buckets []*Bucket
+	for _, b := range []*Bucket{bw.Global, bw.PerIP.Get(ip), bw.path(p)} {
+		if b != nil {
+			buckets = append(buckets, b)
+		}
+	}
+	return buckets
+}
+
+// Writer throttles the writes to an io.Writer by all of its buckets.
+type Writer struct {
+	W       io.Writer
+	Ctx     context.Context
+	Buckets []*Bucket
+	// BeforeWait is called with the time the next write waits for, if set.
+	BeforeWait func(time.Duration)
+}
+
+// Write writes p in chunks no bigger than the smallest burst, waiting for each of them to be allowed.
+func (w *Writer) Write(p []byte) (int, error) {
+	chunk := len(p)
+	for _, b := range w.Buckets {
+		if burst := b.Burst(); burst < chunk {
+			chunk = burst
+		}
+	}
+
+	written := 0
+	for written < len(p) {
+		n := chunk
+		if len(p)-written < n {
+			n = len(p) - written
+		}
+
+		var wait time.Duration
+		for _, b := range w.Buckets {
+			if d := b.Reserve(n); d > wait {
+				wait = d
+			}
+		}
+		if wait > 0 {
+			if w.BeforeWait != nil {
+				w.BeforeWait(wait)
+			}
+			if err := sleep(w.Ctx, wait); err != nil {
+				return written, err
+			}
+		}
+
+		m, err := w.W.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func TestBucket(t *testing.T) {
+	c := &clock{time.Now()}
+	b := NewBucket(2, 3)
+	b.now = c.now
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Allow(); !ok {
+			t.Fatalf("expected request %d to be allowed within the burst", i+1)
+		}
+	}
+	if ok, wait := b.Allow(); ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %v, %s", ok, wait)
+	}
+
+	c.t = c.t.Add(time.Second)
+	if ok, _ := b.Allow(); !ok {
+		t.Fatal("expected the bucket to be refilled")
+	}
+
+	if wait := b.Reserve(4); wait != 1500*time.Millisecond {
+		t.Errorf("expected to wait 1.5s for the reservation, got %s", wait)
+	}
+
+	if NewBucket(0, 10) != nil {
+		t.Error("expected a rate of 0 to disable the bucket")
+	}
+	var disabled *Bucket
+	if ok, _ := disabled.Allow(); !ok || disabled.Reserve(100) != 0 {
+		t.Error("expected a nil bucket to never limit")
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	c := &clock{time.Now()}
+	k := NewKeyed(1, 1)
+	k.now = c.now
+
+	if ok, _ := k.Get("a").Allow(); !ok {
+		t.Fatal("expected the first request of a to be allowed")
+	}
+	if ok, _ := k.Get("a").Allow(); ok {
+		t.Fatal("expected the second request of a to be limited")
+	}
+	if ok, _ := k.Get("b").Allow(); !ok {
+		t.Fatal("expected b to have its own bucket")
+	}
+
+	c.t = c.t.Add(2 * pruneEvery)
+	k.Get("c")
+	if n := k.Len(); n != 1 {
+		t.Errorf("expected the idle buckets to be pruned, got %d", n)
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	bw := new(Bandwidth)
+	bw.SetPath("/isos/", 100)
+	bw.SetPath("/isos/big", 10)
+	bw.PerIP = NewKeyed(1000, 0)
+
+	tests := []struct {
+		path    string
+		buckets int
+		burst   int
+	}{
+		{"/isos/a.iso", 2, 100},
+		{"/isos/big/b.iso", 2, 10},
+		{"/isosa", 1, 1000},
+	}
+	for _, test := range tests {
+		buckets := bw.Buckets("192.0.2.1", test.path)
+		if len(buckets) != test.buckets {
+			t.Fatalf("%s: expected %d buckets, got %d", test.path, test.buckets, len(buckets))
+		}
+		if burst := buckets[len(buckets)-1].Burst(); burst != test.burst {
+			t.Errorf("%s: expected a burst of %d, got %d", test.path, test.burst, burst)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var waited time.Duration
+	w := &Writer{
+		W:          &buf,
+		Buckets:    []*Bucket{NewBucket(1000, 10)},
+		BeforeWait: func(d time.Duration) { waited += d },
+	}
+
+	data := bytes.Repeat([]byte("x"), 30)
+	if n, err := w.Write(data); err != nil || n != len(data) {
+		t.Fatalf("expected %d bytes written, got %d, %v", len(data), n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("expected the data to be written unchanged")
+	}
+	if waited < 15*time.Millisecond {
+		t.Errorf("expected the writes over the burst to wait, waited %s", waited)
+	}
+}
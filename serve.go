@@ -0,0 +1,167 @@
+package main
+
+import (
+	"filekeep/audit"
+	"filekeep/config"
+	"filekeep/logfile"
+	"filekeep/web"
+	"filekeep/webhook"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handler serves requests with the latest handler stored, so the config can be reloaded.
+type handler struct {
+	v atomic.Value
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.v.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// reload loads the config file again, and replaces the handler with one built from it.
+// The listening addresses, access log, audit log and webhook queue need a restart to change.
+func reload(h *handler, opts web.Options) {
+	entry := audit.Entry{Type: audit.ConfigReload, Path: *configFlag}
+	defer func() {
+		if err := opts.Audit.Record(entry); err != nil {
+			logrus.WithError(err).Error("couldn't record audit log entry")
+		}
+	}()
+
+	if *configFlag == "" {
+		entry.Detail = "no config file to reload"
+		logrus.Warn("no config file to reload, use -config")
+		return
+	}
+
+	newC, err := config.Load(*configFlag, overrides()...)
+	if err != nil {
+		entry.Detail = err.Error()
+		logConfigError(err)
+		logrus.Error("couldn't reload config, keeping the previous one")
+		return
+	}
+	c = newC
+
+	newOpts := web.OptionsFromConfig(c)
+	newOpts.AccessLog, newOpts.Audit, newOpts.Webhooks = opts.AccessLog, opts.Audit, opts.Webhooks
+	opts.Webhooks.SetHooks(web.Webhooks(c))
+	// keep the tracked failures, the admin listener shows these guards
+	newOpts.IPGuard, newOpts.PathGuard = opts.IPGuard, opts.PathGuard
+	opts.IPGuard.SetPolicy(web.GuardPolicy(c.BruteForce.IP))
+	opts.PathGuard.SetPolicy(web.GuardPolicy(c.BruteForce.Path))
+	// keep the running jobs, the number of workers needs a restart to change
+	if opts.Jobs != nil && newOpts.Jobs != nil {
+		newOpts.Jobs = opts.Jobs
+	}
+	// keep the watches of the open event streams
+	if opts.Events != nil && newOpts.Events != nil {
+		newOpts.Events.Close()
+		newOpts.Events = opts.Events
+	}
+	h.v.Store(web.NewHandler(newOpts))
+
+	entry.Success = true
+	logrus.WithField("config", *configFlag).Info("reloaded config")
+}
+
+// serveCommand serves the files until the server fails, and returns the exit code.
+func serveCommand(args []string) int {
+	flags := newFlagSet("serve", "")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		logConfigError(err)
+		return exitFailure
+	}
+
+	opts := web.OptionsFromConfig(c)
+	if c.AccessLog.Path == "-" {
+		opts.AccessLog = os.Stdout
+	} else if c.AccessLog.Path != "" {
+		f, err := logfile.Open(c.AccessLog.Path, int64(c.AccessLog.MaxSize), c.AccessLog.MaxAge, c.AccessLog.MaxBackups)
+		if err != nil {
+			logrus.WithError(err).Error("couldn't open access log")
+			return exitFailure
+		}
+		defer f.Close()
+		onReopen(func() {
+			if err := f.Reopen(); err != nil {
+				logrus.WithError(err).Error("couldn't reopen access log")
+				return
+			}
+			logrus.WithField("path", f.Path).Info("reopened access log")
+		})
+		opts.AccessLog = f
+	}
+
+	if c.AuditLog != "" {
+		l, err := audit.Open(c.AuditLog)
+		if err != nil {
+			logrus.WithError(err).Error("couldn't open audit log")
+			return exitFailure
+		}
+		defer l.Close()
+		opts.Audit = l
+	}
+
+	webhookOpts := webhook.Options{
+		Queue:       c.Webhooks.Queue,
+		Timeout:     c.Webhooks.Timeout,
+		MaxAttempts: c.Webhooks.MaxAttempts,
+		Backoff:     c.Webhooks.Backoff,
+		MaxBackoff:  c.Webhooks.MaxBackoff,
+	}
+	if c.Webhooks.Log != "" {
+		f, err := logfile.Open(c.Webhooks.Log, 0, 0, 0)
+		if err != nil {
+			logrus.WithError(err).Error("couldn't open webhook delivery log")
+			return exitFailure
+		}
+		defer f.Close()
+		onReopen(func() {
+			if err := f.Reopen(); err != nil {
+				logrus.WithError(err).Error("couldn't reopen webhook delivery log")
+			}
+		})
+		webhookOpts.Log = f
+	}
+	hooks, err := webhook.New(web.Webhooks(c), webhookOpts)
+	if err != nil {
+		logrus.WithError(err).Error("couldn't start webhooks")
+		return exitFailure
+	}
+	defer hooks.Close()
+	opts.Webhooks = hooks
+
+	if c.Admin.Port != 0 {
+		adminOpts := opts
+		adminOpts.Metrics = c.Metrics
+		admin := web.NewHTTPServer(c.Admin.String(), web.NewAdminHandler(adminOpts))
+		go func() {
+			logrus.WithField("address", c.Admin.String()).Info("starting admin server")
+			if err := admin.ListenAndServe(); err != nil {
+				logrus.WithError(err).Error("error while serving the admin server")
+				os.Exit(exitFailure)
+			}
+		}()
+	}
+
+	h := new(handler)
+	h.v.Store(web.NewHandler(opts))
+	onReload(func() { reload(h, opts) })
+
+	server := web.NewHTTPServer(c.Web.String(), h)
+	logrus.WithField("address", c.Web.String()).Info("starting server")
+	// ListenAndServe always returns an error
+	err = server.ListenAndServe()
+	logrus.WithError(err).Error("error while serving the web server")
+	return exitFailure
+}
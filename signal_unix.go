@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// onSignal calls fn every time the process receives sig.
+func onSignal(sig os.Signal, fn func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig)
+	go func() {
+		for range ch {
+			fn()
+		}
+	}()
+}
+
+// onReopen calls fn every time the process receives SIGUSR1, to reopen the log files.
+func onReopen(fn func()) {
+	onSignal(syscall.SIGUSR1, fn)
+}
+
+// onReload calls fn every time the process receives SIGHUP, to reload the config.
+func onReload(fn func()) {
+	onSignal(syscall.SIGHUP, fn)
+}
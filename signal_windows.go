@@ -0,0 +1,7 @@
+package main
+
+// onReopen does nothing on Windows, which has no SIGUSR1.
+func onReopen(fn func()) {}
+
+// onReload does nothing on Windows, which has no SIGHUP.
+func onReload(fn func()) {}
@@ -0,0 +1,123 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects the changes reported: files done being written count as modified, and renames
+// count as creations and deletions.
+const inotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_MOVED_TO |
+	unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_ONLYDIR
+
+// inotify watches directories with a single inotify instance.
+type inotify struct {
+	h  *Hub
+	fd int
+
+	mu   sync.Mutex
+	wds  map[int]string
+	dirs map[string]int
+	done chan struct{}
+	once sync.Once
+}
+
+func newInotify(h *Hub) (backend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize inotify: %s", err)
+	}
+	in := &inotify{h: h, fd: fd, wds: make(map[int]string), dirs: make(map[string]int), done: make(chan struct{})}
+	go in.run()
+	return in, nil
+}
+
+func (in *inotify) add(dir string) error {
+	wd, err := unix.InotifyAddWatch(in.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("couldn't watch %q: %s", dir, err)
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.wds[wd], in.dirs[dir] = dir, wd
+	return nil
+}
+
+func (in *inotify) remove(dir string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if wd, ok := in.dirs[dir]; ok {
+		unix.InotifyRmWatch(in.fd, uint32(wd))
+		delete(in.dirs, dir)
+		delete(in.wds, wd)
+	}
+}
+
+func (in *inotify) close() error {
+	in.once.Do(func() { close(in.done) })
+	return nil
+}
+
+// run reads the events until closed, polling the descriptor with a timeout so it notices being closed.
+func (in *inotify) run() {
+	defer unix.Close(in.fd)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	fds := []unix.PollFd{{Fd: int32(in.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-in.done:
+			return
+		default:
+		}
+
+		if n, err := unix.Poll(fds, 500); err != nil || n == 0 {
+			continue
+		}
+		n, err := unix.Read(in.fd, buf)
+		if err != nil || n < unix.SizeofInotifyEvent {
+			continue
+		}
+		in.parse(buf[:n])
+	}
+}
+
+// parse dispatches the events read in buf.
+func (in *inotify) parse(buf []byte) {
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		offset = nameStart + int(raw.Len)
+		if offset > len(buf) {
+			return
+		}
+		name := string(bytes.TrimRight(buf[nameStart:offset], "\x00"))
+
+		in.mu.Lock()
+		dir, ok := in.wds[int(raw.Wd)]
+		if raw.Mask&unix.IN_IGNORED != 0 {
+			// the directory was removed, or its watch was
+			delete(in.wds, int(raw.Wd))
+			if in.dirs[dir] == int(raw.Wd) {
+				delete(in.dirs, dir)
+			}
+		}
+		in.mu.Unlock()
+		if !ok || name == "" {
+			continue
+		}
+
+		switch {
+		case raw.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			in.h.dispatch(Event{Create, dir, name})
+		case raw.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+			in.h.dispatch(Event{Delete, dir, name})
+		case raw.Mask&(unix.IN_CLOSE_WRITE|unix.IN_ATTRIB) != 0:
+			in.h.dispatch(Event{Modify, dir, name})
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import "errors"
+
+func newInotify(h *Hub) (backend, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileState is what the poller compares to find modified files.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+// poller lists the watched directories every interval, and compares them with the previous listing.
+type poller struct {
+	h        *Hub
+	interval time.Duration
+
+	mu   sync.Mutex
+	dirs map[string]map[string]fileState
+	done chan struct{}
+	once sync.Once
+}
+
+func newPoller(h *Hub, interval time.Duration) *poller {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	p := &poller{h: h, interval: interval, dirs: make(map[string]map[string]fileState), done: make(chan struct{})}
+	go p.run()
+	return p
+}
+
+func list(dir string) (map[string]fileState, error) {
+	ls, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]fileState, len(ls))
+	for _, info := range ls {
+		files[info.Name()] = fileState{info.Size(), info.ModTime(), info.Mode()}
+	}
+	return files, nil
+}
+
+func (p *poller) add(dir string) error {
+	files, err := list(dir)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirs[dir] = files
+	return nil
+}
+
+func (p *poller) remove(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.dirs, dir)
+}
+
+func (p *poller) close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *poller) run() {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			p.poll()
+		}
+	}
+}
+
+// poll lists the watched directories again, dispatching the differences as events.
+func (p *poller) poll() {
+	p.mu.Lock()
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	p.mu.Unlock()
+
+	for _, dir := range dirs {
+		files, err := list(dir)
+		if err != nil {
+			files = make(map[string]fileState)
+		}
+
+		p.mu.Lock()
+		old, ok := p.dirs[dir]
+		if ok {
+			p.dirs[dir] = files
+		}
+		p.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		for name, state := range files {
+			prev, existed := old[name]
+			switch {
+			case !existed:
+				p.h.dispatch(Event{Create, dir, name})
+			case prev != state:
+				p.h.dispatch(Event{Modify, dir, name})
+			}
+		}
+		for name := range old {
+			if _, ok := files[name]; !ok {
+				p.h.dispatch(Event{Delete, dir, name})
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package watch reports the files created, modified and deleted in directories, with inotify on Linux,
+// or by polling the directories elsewhere.
+package watch
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The operations of events.
+const (
+	Create = "create"
+	Modify = "modify"
+	Delete = "delete"
+)
+
+// Event is a change of a file or directory in a watched directory.
+type Event struct {
+	// Op is one of Create, Modify or Delete.
+	Op string
+	// Dir is the watched directory.
+	Dir string
+	// Name is the name of the changed file or directory in Dir.
+	Name string
+}
+
+// Path returns the path of the changed file or directory.
+func (e Event) Path() string {
+	return filepath.Join(e.Dir, e.Name)
+}
+
+// backend watches directories, and sends their events to the Hub.
+type backend interface {
+	add(dir string) error
+	remove(dir string)
+	close() error
+}
+
+// subscriberBuffer is the number of events buffered for each subscriber, further events are dropped
+// until it catches up.
+const subscriberBuffer = 64
+
+// Hub watches the directories its subscribers are interested in, as long as they are. Safe for concurrent use.
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[string]map[chan Event]struct{}
+	backend backend
+}
+
+// New returns a Hub using inotify if available, otherwise polling the watched directories every interval.
+func New(interval time.Duration) *Hub {
+	h := &Hub{subs: make(map[string]map[chan Event]struct{})}
+	b, err := newInotify(h)
+	if err != nil {
+		logrus.WithError(err).Debug("couldn't use inotify, polling directories for changes")
+		h.backend = newPoller(h, interval)
+		return h
+	}
+	h.backend = b
+	return h
+}
+
+// Subscribe returns the events of the directory dir, until cancel is called.
+func (h *Hub) Subscribe(dir string) (events <-chan Event, cancel func(), err error) {
+	dir = filepath.Clean(dir)
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs[dir]) == 0 {
+		if err := h.backend.add(dir); err != nil {
+			return nil, nil, err
+		}
+		h.subs[dir] = make(map[chan Event]struct{})
+	}
+	h.subs[dir][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() { once.Do(func() { h.unsubscribe(dir, ch) }) }, nil
+}
+
+func (h *Hub) unsubscribe(dir string, ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[dir], ch)
+	if len(h.subs[dir]) == 0 {
+		delete(h.subs, dir)
+		h.backend.remove(dir)
+	}
+}
+
+// dispatch sends the event to the subscribers of its directory, without waiting for slow ones.
+func (h *Hub) dispatch(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[e.Dir] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Close stops watching all directories. The subscribers don't get any more events.
+func (h *Hub) Close() error {
+	return h.backend.close()
+}
@@ -0,0 +1,78 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func next(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+		return Event{}
+	}
+}
+
+func testHub(t *testing.T, h *Hub) {
+	dir, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer h.Close()
+
+	events, cancel, err := h.Subscribe(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	path := filepath.Join(dir, "new.txt")
+	if err := ioutil.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, events); e.Op != Create || e.Path() != path {
+		t.Errorf("expected the creation of %s, got %+v", path, e)
+	}
+
+	// the poller can't see changes within the same tick, drain the events of the creation
+	time.Sleep(100 * time.Millisecond)
+	for len(events) > 0 {
+		<-events
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, events); e.Op != Modify || e.Name != "new.txt" {
+		t.Errorf("expected the modification of new.txt, got %+v", e)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, events); e.Op != Delete || e.Name != "new.txt" {
+		t.Errorf("expected the deletion of new.txt, got %+v", e)
+	}
+
+	cancel()
+	if len(h.subs) != 0 {
+		t.Error("expected the directory not to be watched anymore")
+	}
+}
+
+func TestHub(t *testing.T) {
+	testHub(t, New(10*time.Millisecond))
+}
+
+func TestPoller(t *testing.T) {
+	h := &Hub{subs: make(map[string]map[chan Event]struct{})}
+	h.backend = newPoller(h, 10*time.Millisecond)
+	testHub(t, h)
+}
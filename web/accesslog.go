@@ -0,0 +1,99 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accessLog writes a line for every request, in the Apache combined log format or as JSON.
+type accessLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	json bool
+}
+
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	ClientIP  string    `json:"client_ip"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"duration"`
+	Route     string    `json:"route"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+func newAccessLog(w io.Writer, format string) *accessLog {
+	if w == nil {
+		return nil
+	}
+	return &accessLog{w: w, json: format == "json"}
+}
+
+// combined returns the entry in the Apache combined log format, followed by the duration in seconds.
+func (e *accessEntry) combined() string {
+	user, size := "-", "-"
+	if e.User != "" {
+		user = e.User
+	}
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %s %s %s %.3f\n",
+		e.ClientIP, user, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(e.Method+" "+e.URI+" "+e.Proto), e.Status, size,
+		strconv.Quote(e.Referer), strconv.Quote(e.UserAgent), e.Duration)
+}
+
+func (l *accessLog) log(e *accessEntry) error {
+	var line []byte
+	if l.json {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(b, '\n')
+	} else {
+		line = []byte(e.combined())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(line)
+	return err
+}
+
+// logAccess writes the access log entry of a served request.
+func (s *server) logAccess(rw *responseWriter, r *http.Request, start time.Time) {
+	if s.access == nil {
+		return
+	}
+
+	user, _ := s.tokenAuth(r)
+	e := &accessEntry{
+		Time:      start,
+		ClientIP:  s.clientIP(r),
+		User:      user,
+		Method:    r.Method,
+		URI:       r.RequestURI,
+		Proto:     r.Proto,
+		Status:    rw.status(),
+		Bytes:     rw.bytes,
+		Duration:  time.Since(start).Seconds(),
+		Route:     rw.route,
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+	if err := s.access.log(e); err != nil {
+		s.log.WithError(err).Error("couldn't write access log")
+	}
+}
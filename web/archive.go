@@ -0,0 +1,51 @@
+package web
+
+import (
+	"encoding/hex"
+	"filekeep/fs"
+	"filekeep/metrics"
+	"fmt"
+	"net/http"
+)
+
+// serveMember serves the content of the archive member n, extracting it as it goes.
+func (s *server) serveMember(w http.ResponseWriter, r *http.Request, n *fs.Node) {
+	rs, closer, err := s.fs.OpenMember(n)
+	if err == fs.ErrMemberTooBig {
+		res := httpResponse{Error: true, Message: "archive member too big to download, download the whole archive"}
+		res.JSON(http.StatusRequestEntityTooLarge, w)
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).Errorf("couldn't open archive member %q", n.Path)
+		s.notFoundHandler(w, r)
+		return
+	}
+	defer closer.Close()
+
+	metrics.ActiveDownloads.Inc()
+	defer metrics.ActiveDownloads.Dec()
+	// ServeContent answers the conditional and range requests itself
+	w.Header().Set("ETag", fileETag(n))
+	http.ServeContent(s.throttle(w, r), r, n.Name, n.ModTime, rs)
+}
+
+// memberChecksumHandler responds with the checksum of the archive member n, in the format of the checksum
+// of files. Checksum manifests aren't available inside archives.
+func (s *server) memberChecksumHandler(w http.ResponseWriter, r *http.Request, n *fs.Node, algorithm string) {
+	if n.IsDir {
+		res := httpResponse{Error: true, Message: "checksum manifests aren't available inside archives"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+
+	sum, err := s.fs.MemberSum(n, algorithm)
+	if err != nil {
+		s.log.WithError(err).Errorf("couldn't compute checksum of archive member %q", n.Path)
+		res := httpResponse{Error: true, Message: "couldn't compute checksum"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(sum), n.Name)
+}
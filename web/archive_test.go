@@ -0,0 +1,81 @@
+package web
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"filekeep/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchiveMembers(t *testing.T) {
+	root := tempRoot(t)
+	f, err := os.Create(filepath.Join(root, "bundle.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("docs/readme.txt")
+	w.Write([]byte("read me, inside the archive"))
+	zw.Close()
+	f.Close()
+
+	h := NewHandler(Options{Root: root, Archives: fs.NewArchives(0, 0, 0), Tokens: map[string]string{"ci": "s3cret"}})
+
+	res := get(t, h, "/")
+	if !strings.Contains(res.Body.String(), `href="/bundle.zip/">browse</a>`) {
+		t.Error("expected the listing to link to the archive's members")
+	}
+
+	res = get(t, h, "/bundle.zip/")
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `href="/bundle.zip/docs"`) {
+		t.Errorf("expected the archive to be listed, got %d", res.Code)
+	}
+
+	res = get(t, h, "/bundle.zip/docs?json")
+	var n struct {
+		Files []struct{ Name, Path string }
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &n); err != nil || len(n.Files) != 1 || n.Files[0].Path != "/bundle.zip/docs/readme.txt" {
+		t.Errorf("expected the JSON listing of the member directory, got %s", res.Body)
+	}
+
+	res = get(t, h, "/bundle.zip/docs/readme.txt")
+	if res.Code != http.StatusOK || res.Body.String() != "read me, inside the archive" {
+		t.Errorf("expected the member's content, got %d %q", res.Code, res.Body)
+	}
+
+	r := httptest.NewRequest("GET", "/bundle.zip/docs/readme.txt", nil)
+	r.Header.Set("Range", "bytes=9-14")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "inside" {
+		t.Errorf("expected a range of the member, got %d %q", rec.Code, rec.Body)
+	}
+
+	res = get(t, h, "/bundle.zip/docs/readme.txt?checksum=md5")
+	if !strings.HasSuffix(res.Body.String(), "  readme.txt\n") || len(res.Body.String()) != 32+len("  readme.txt\n") {
+		t.Errorf("expected the checksum of the member, got %q", res.Body)
+	}
+
+	r = httptest.NewRequest("DELETE", "/bundle.zip/docs/readme.txt", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting a member, got %d", rec.Code)
+	}
+
+	if res := get(t, h, "/bundle.zip/../../etc/passwd"); res.Code != http.StatusNotFound {
+		t.Errorf("expected 404 outside of the root, got %d", res.Code)
+	}
+
+	h = NewHandler(Options{Root: root})
+	if res := get(t, h, "/bundle.zip/docs/readme.txt"); res.Code != http.StatusNotFound {
+		t.Errorf("expected 404 with the archives disabled, got %d", res.Code)
+	}
+}
@@ -0,0 +1,25 @@
+package web
+
+import (
+	"filekeep/audit"
+	"net/http"
+	"path"
+)
+
+// audit records the event e caused by the request r in the audit log, if enabled.
+func (s *server) audit(r *http.Request, e audit.Entry) {
+	if s.opts.Audit == nil {
+		return
+	}
+
+	if e.Path == "" {
+		e.Path = path.Clean("/" + r.URL.Path)
+	}
+	e.Site = s.host
+	e.Client = s.clientIP(r)
+	e.User, _ = s.tokenAuth(r)
+
+	if err := s.opts.Audit.Record(e); err != nil {
+		s.log.WithError(err).Error("couldn't record audit log entry")
+	}
+}
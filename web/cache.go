@@ -0,0 +1,155 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"filekeep/assets/css"
+	"filekeep/assets/templates"
+	"filekeep/fs"
+	"filekeep/metrics"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// stylesheet is a CSS asset served at /_assets/, with a version to bust the caches when it changes.
+type stylesheet struct {
+	Path    string
+	Version string
+	content string
+}
+
+// stylesheets are linked by the header, in order.
+var stylesheets = []stylesheet{
+	newStylesheet("hack.min.css", css.HackCSS),
+	newStylesheet("hack-dark.min.css", css.HackDarkCSS),
+	newStylesheet("custom.css", css.CustomCSS),
+}
+
+func newStylesheet(name, content string) stylesheet {
+	sum := sha256.Sum256([]byte(content))
+	return stylesheet{Path: "_assets/" + name, Version: hex.EncodeToString(sum[:6]), content: content}
+}
+
+// templatesVersion changes with the templates, so pages rendered by another version don't match.
+var templatesVersion = func() string {
+	h := fnv.New64a()
+	for _, t := range []string{templates.HTMLHeader, templates.HTMLFooter, templates.HTMLDirList} {
+		h.Write([]byte(t))
+	}
+	return fmt.Sprintf("%x", h.Sum64())
+}()
+
+// serveStylesheet serves the stylesheet at the URL path, if any. Requests for its current version
+// may be cached forever, as the version changes with the content.
+func (s *server) serveStylesheet(w http.ResponseWriter, r *http.Request, path string) bool {
+	for _, sheet := range stylesheets {
+		if path != "/"+sheet.Path {
+			continue
+		}
+
+		setRoute(w, "asset")
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("ETag", `"`+sheet.Version+`"`)
+		if r.URL.Query().Get("v") == sheet.Version {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "public, no-cache")
+		}
+		http.ServeContent(w, r, sheet.Path, time.Time{}, strings.NewReader(sheet.content))
+		return true
+	}
+	return false
+}
+
+// cacheControl returns the Cache-Control header for the URL path, configured for its longest prefix.
+// Protected files and directories are never stored by shared caches.
+func (s *server) cacheControl(path string, protected bool) string {
+	if protected {
+		return "private, no-cache"
+	}
+
+	var match, value string
+	for prefix, v := range s.opts.CacheControl {
+		if prefix, ok := underPrefix(path, prefix); ok && len(prefix) >= len(match) {
+			match, value = prefix, v
+		}
+	}
+	return value
+}
+
+// underPrefix returns the cleaned URL path prefix, and whether path is under it.
+func underPrefix(path, prefix string) (string, bool) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	return prefix, prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// listingETag returns a weak ETag for the listing of n, as HTML or JSON. HTML pages also depend
+// on the templates, the theme and the links' prefix.
+func (s *server) listingETag(r *http.Request, n *fs.Node, asJSON bool) string {
+	variant := "json"
+	if !asJSON {
+		variant = fmt.Sprintf("html\x00%s\x00%t\x00%s", templatesVersion, s.darkTheme(r), s.linksOf(r).Href("."))
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(n.Version()))
+	h.Write([]byte(variant))
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// fileETag returns a weak ETag for the file n, from its size and modification time.
+func fileETag(n *fs.Node) string {
+	return fmt.Sprintf(`W/"%x-%x"`, int64(n.Size), n.ModTime.UnixNano())
+}
+
+// notModified sets the validators of the response, and returns whether the client's copy is still fresh
+// according to its If-None-Match or If-Modified-Since header, in which case it responds with 304 Not Modified.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	inm, ims := r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since")
+	if inm == "" && ims == "" {
+		return false
+	}
+
+	fresh := false
+	if inm != "" {
+		// If-Modified-Since is ignored when If-None-Match is present
+		fresh = etagMatch(inm, etag)
+	} else if t, err := http.ParseTime(ims); err == nil && !modTime.IsZero() {
+		fresh = !modTime.Truncate(time.Second).After(t)
+	}
+
+	if !fresh {
+		metrics.CacheMiss("http")
+		return false
+	}
+
+	metrics.CacheHit("http")
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch returns whether the If-None-Match header list matches etag, with a weak comparison.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
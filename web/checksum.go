@@ -0,0 +1,116 @@
+package web
+
+import (
+	"encoding/base64"
+	"filekeep/fs"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// checksumHandler responds with the checksum of the file, or with the checksum manifest of all files
+// under the directory, in the format of the coreutils tools like sha256sum.
+func (s *server) checksumHandler(w http.ResponseWriter, r *http.Request, path string, n *fs.Node, algorithm string) {
+	setRoute(w, "checksum")
+	if _, ok := fs.Algorithms[algorithm]; !ok {
+		res := httpResponse{Error: true, Message: "unknown checksum algorithm, use one of " + strings.Join(fs.AlgorithmNames(), ", ")}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+
+	if n.InArchive() {
+		s.memberChecksumHandler(w, r, n, algorithm)
+		return
+	}
+	if n.IsDir {
+		s.serveManifest(w, r, path, algorithm)
+		return
+	}
+
+	sum, err := s.sums.Hex(path, algorithm)
+	if err != nil {
+		s.log.WithError(err).Errorf("couldn't compute checksum of %q", path)
+		res := httpResponse{Error: true, Message: "couldn't compute checksum"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s  %s\n", sum, n.Name)
+}
+
+// manifestHandler serves the checksum manifest of the directory at dir, for a request of a manifest file
+// like SHA256SUMS that doesn't exist. It returns false if dir isn't a directory.
+func (s *server) manifestHandler(w http.ResponseWriter, r *http.Request, dir, algorithm string) bool {
+	n, err := s.fs.Stat(dir)
+	if err != nil || !n.IsDir {
+		return false
+	}
+
+	setRoute(w, "checksum")
+	if s.checkPass(n, w, r) {
+		s.serveManifest(w, r, dir, algorithm)
+	}
+	return true
+}
+
+// serveManifest streams the checksum manifest of the directory at dir, computing the checksums as it goes.
+// Without an API token, it only goes as deep as the listings.
+func (s *server) serveManifest(w http.ResponseWriter, r *http.Request, dir, algorithm string) {
+	depth := fs.ManifestDepth
+	if _, ok := s.tokenAuth(r); ok {
+		depth = -1
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rc := http.NewResponseController(w)
+	err := s.fs.Manifest(dir, algorithm, depth, s.sums, func(path, sum string) error {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", sum, path); err != nil {
+			return err
+		}
+		rc.Flush()
+		// big directories may well take longer than the server's write timeout
+		rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return r.Context().Err()
+	})
+	if err != nil {
+		s.log.WithError(err).Errorf("couldn't write checksum manifest of %q", dir)
+	}
+}
+
+// setDigest sets the Repr-Digest and Digest headers with the SHA-256 of the file at path, if it's cached,
+// if the client asked for it with Want-Repr-Digest or Want-Digest, or if the file is at most DigestMaxSize.
+// It's never computed for range and conditional requests, which may well not need the whole file read.
+func (s *server) setDigest(w http.ResponseWriter, r *http.Request, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	sum, ok := s.sums.Cached(path, info, "sha256")
+	wanted := r.Header.Get("Want-Repr-Digest") != "" || r.Header.Get("Want-Digest") != ""
+	if !ok && !partial(r) && (wanted || (s.opts.DigestMaxSize > 0 && info.Size() <= s.opts.DigestMaxSize)) {
+		if sum, err = s.sums.Sum(path, "sha256"); err != nil {
+			s.log.WithError(err).Errorf("couldn't compute digest of %q", path)
+			return
+		}
+	}
+	if sum == nil {
+		return
+	}
+
+	b64 := base64.StdEncoding.EncodeToString(sum)
+	w.Header().Set("Repr-Digest", "sha-256=:"+b64+":")
+	w.Header().Set("Digest", "SHA-256="+b64)
+}
+
+// partial returns whether the request is a range or conditional one.
+func partial(r *http.Request) bool {
+	for _, header := range []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if r.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
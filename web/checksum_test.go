@@ -0,0 +1,89 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	h := NewHandler(Options{
+		Root:          tempRoot(t, "rel/a.txt", "rel/sub/b.txt", "rel/sub/deep/c.txt", "rel/.hidden"),
+		DigestMaxSize: 1024,
+		Tokens:        map[string]string{"ci": "s3cret"},
+	})
+
+	// sha256sum of "rel/a.txt", "rel/sub/b.txt" and "rel/sub/deep/c.txt", the contents written by tempRoot
+	const (
+		sumA = "acb660ac3b8db82aa680d24098a68ac4026739566fc2897e4039fcc01ef8e981"
+		sumB = "56fc68ff7773801e86c11d93855e189d01fb64607a1e28649b43034a9fc70a60"
+		sumC = "b27eaf84ff96cacbe16bad658097b73a68cae4b94807d77e8375d1853fc5a0d0"
+	)
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+		body   string
+	}{
+		{"file", "/rel/a.txt?checksum=sha256", http.StatusOK, sumA + "  a.txt\n"},
+		{"md5", "/rel/a.txt?checksum=md5", http.StatusOK, "6d0d13fa2696929ed1bbacb42573b923  a.txt\n"},
+		{"blake2b", "/rel/a.txt?checksum=blake2b", http.StatusOK, "e296bfcf580988e5fe3468e4903499ab1a2b2bee38dd6e443744c08a3ebee4c682653228cf18ad5475cdb586a39ec9d1a1eba264a797abaa61a12cdf73de655e  a.txt\n"},
+		{"unknown", "/rel/a.txt?checksum=crc32", http.StatusBadRequest, ""},
+		{"directory", "/rel?checksum=sha256", http.StatusOK, sumA + "  a.txt\n" + sumB + "  sub/b.txt\n"},
+		{"manifest", "/rel/SHA256SUMS", http.StatusOK, sumA + "  a.txt\n" + sumB + "  sub/b.txt\n"},
+		{"missing", "/missing/SHA256SUMS", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := get(t, h, test.target)
+			if w.Code != test.code {
+				t.Fatalf("expected status %d, got %d", test.code, w.Code)
+			}
+			if test.body != "" && w.Body.String() != test.body {
+				t.Errorf("expected body %q, got %q", test.body, w.Body.String())
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/rel/SHA256SUMS", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if body := sumA + "  a.txt\n" + sumB + "  sub/b.txt\n" + sumC + "  sub/deep/c.txt\n"; w.Body.String() != body {
+		t.Errorf("expected the whole manifest with a token, got %q", w.Body.String())
+	}
+
+	w = get(t, h, "/rel/a.txt")
+	if digest := w.Header().Get("Repr-Digest"); digest != "sha-256=:rLZgrDuNuCqmgNJAmKaKxAJnOVZvwol+QDn8wB746YE=:" {
+		t.Errorf("unexpected Repr-Digest %q", digest)
+	}
+
+	h = NewHandler(Options{Root: tempRoot(t, "a.txt")})
+	if w := get(t, h, "/a.txt"); w.Header().Get("Repr-Digest") != "" {
+		t.Error("expected no digest over DigestMaxSize")
+	}
+	for header, value := range map[string]string{"Range": "bytes=0-1", "If-None-Match": `"v1"`} {
+		r = httptest.NewRequest("GET", "/a.txt", nil)
+		r.Header.Set("Want-Repr-Digest", "sha-256=1")
+		r.Header.Set(header, value)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Header().Get("Repr-Digest") != "" {
+			t.Errorf("expected no digest computed with a %s header", header)
+		}
+	}
+	r = httptest.NewRequest("GET", "/a.txt", nil)
+	r.Header.Set("Want-Repr-Digest", "sha-256=1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Repr-Digest") == "" || w.Header().Get("Digest") == "" {
+		t.Error("expected the digest to be computed when asked for")
+	}
+	r.Header.Set("Range", "bytes=0-1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || w.Header().Get("Repr-Digest") == "" {
+		t.Error("expected the cached digest with a range request")
+	}
+}
@@ -0,0 +1,323 @@
+package web
+
+import (
+	"compress/gzip"
+	"filekeep/config"
+	"filekeep/fs"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression configures the compression of responses.
+type Compression struct {
+	// MinSize is the size in bytes under which responses aren't compressed.
+	MinSize int64
+	// Types are the compressed media types, like "text/html", or "text/*" for all text types.
+	Types []string
+	// Precompressed serves the .br, .zst or .gz sibling of a file instead of it, if present and
+	// not older than the file.
+	Precompressed bool
+}
+
+// CompressionFromConfig returns the compression described by the config, nil if disabled.
+func CompressionFromConfig(c *config.Config) *Compression {
+	if !c.Compression.Enabled {
+		return nil
+	}
+	return &Compression{
+		MinSize:       int64(c.Compression.MinSize),
+		Types:         c.Compression.Types,
+		Precompressed: c.Compression.Precompressed,
+	}
+}
+
+// compressible returns whether responses of the content type should be compressed.
+func (c *Compression) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.Types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// encoder is a compressing writer, reusable with Reset.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// encoding is a content coding, with its file extension for precompressed files.
+type encoding struct {
+	name string
+	ext  string
+	pool *sync.Pool
+}
+
+// encodings are the supported content codings, by preference.
+var encodings = []encoding{
+	{"br", ".br", &sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(nil, 4) }}},
+	{"zstd", ".zst", &sync.Pool{New: func() interface{} {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}},
+	{"gzip", ".gz", &sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}},
+}
+
+// acceptedEncodings returns the supported encodings accepted by the request's Accept-Encoding header,
+// by preference: by quality, then by the order of encodings.
+func acceptedEncodings(r *http.Request) []encoding {
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		qs[name] = q
+	}
+
+	var accepted []encoding
+	for _, e := range encodings {
+		q, ok := qs[e.name]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if ok && q > 0 {
+			accepted = append(accepted, e)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return quality(qs, accepted[i].name) > quality(qs, accepted[j].name)
+	})
+	return accepted
+}
+
+func quality(qs map[string]float64, name string) float64 {
+	if q, ok := qs[name]; ok {
+		return q
+	}
+	return qs["*"]
+}
+
+// compress serves the request with next, compressing the response body with the preferred encoding
+// accepted by the client. Range requests are never compressed, so ranges always apply to the file itself.
+func (s *server) compress(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter, *http.Request)) {
+	c := s.opts.Compression
+	if c == nil {
+		next(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	accepted := acceptedEncodings(r)
+	if len(accepted) == 0 || r.Header.Get("Range") != "" {
+		next(w, r)
+		return
+	}
+
+	cw := &compressWriter{ResponseWriter: w, c: c, enc: accepted[0]}
+	defer cw.Close()
+	next(cw, r)
+}
+
+// compressWriter compresses the body of a response, once it knows the response is worth compressing:
+// a successful response of a compressible type, at least MinSize bytes long, and not already encoded.
+type compressWriter struct {
+	http.ResponseWriter
+	c   *Compression
+	enc encoding
+
+	code    int
+	buf     []byte
+	decided bool
+	w       encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.code != 0 {
+		// superfluous, like in net/http
+		return
+	}
+	cw.code = code
+	if code != http.StatusOK {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if h := cw.Header(); h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(cw.buf))
+		}
+		switch {
+		case !cw.worthIt():
+			cw.decide(false)
+		case int64(len(cw.buf)) >= cw.c.MinSize:
+			cw.decide(true)
+		}
+		return len(p), nil
+	}
+
+	if cw.w != nil {
+		return cw.w.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// worthIt returns whether the response may be compressed, from its headers.
+func (cw *compressWriter) worthIt() bool {
+	h := cw.Header()
+	if cw.code != http.StatusOK || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n < cw.c.MinSize {
+		return false
+	}
+	return cw.c.compressible(h.Get("Content-Type"))
+}
+
+// decide writes the header, compressed or not, and the body buffered so far.
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.enc.name)
+		h.Del("Content-Length")
+		// the digests are of the file itself, not of the compressed body
+		h.Del("Repr-Digest")
+		h.Del("Digest")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			// the compressed body is only semantically equivalent
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.w = cw.enc.pool.Get().(encoder)
+		cw.w.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.code)
+	if len(cw.buf) == 0 {
+		return
+	}
+	if cw.w != nil {
+		cw.w.Write(cw.buf)
+	} else {
+		cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+}
+
+// Flush implements http.Flusher, flushing the compressed data written so far.
+func (cw *compressWriter) Flush() {
+	if !cw.decided && cw.code != 0 {
+		cw.decide(cw.worthIt())
+	}
+	if cw.w != nil {
+		cw.w.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close writes the rest of the response, which is compressed only if it reached MinSize.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.code == 0 {
+			// nothing was written, leave it to net/http
+			return nil
+		}
+		cw.decide(cw.worthIt() && int64(len(cw.buf)) >= cw.c.MinSize)
+	}
+	if cw.w == nil {
+		return nil
+	}
+
+	err := cw.w.Close()
+	cw.w.Reset(nil)
+	cw.enc.pool.Put(cw.w)
+	cw.w = nil
+	return err
+}
+
+// servePrecompressed serves the precompressed sibling of the file at path, like "file.txt.gz", with the
+// preferred encoding accepted by the client, if one exists and isn't older than the file. Siblings hidden
+// or with another password than the file are ignored, as they would leak through it.
+func (s *server) servePrecompressed(w http.ResponseWriter, r *http.Request, path string, n *fs.Node) bool {
+	c := s.opts.Compression
+	if c == nil || !c.Precompressed || r.Header.Get("Range") != "" {
+		return false
+	}
+
+	for _, enc := range acceptedEncodings(r) {
+		sibling, err := s.fs.Stat(path + enc.ext)
+		if err != nil || sibling.IsDir || sibling.Password != n.Password || sibling.ModTime.Before(n.ModTime) {
+			continue
+		}
+		f, err := os.Open(path + enc.ext)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		if contentType == "" {
+			contentType = sniff(path)
+		}
+		h := w.Header()
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Encoding", enc.name)
+		http.ServeContent(w, r, n.Name, n.ModTime, f)
+		return true
+	}
+	return false
+}
+
+// sniff detects the content type of the file at path from its first bytes, like http.ServeFile.
+func sniff(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
@@ -0,0 +1,191 @@
+package web
+
+import (
+	"encoding/json"
+	"filekeep/fs"
+	"filekeep/helpers"
+	"fmt"
+	"net/http"
+)
+
+// treemapWidth and treemapHeight are the proportions of the treemap.
+const (
+	treemapWidth  = 160.0
+	treemapHeight = 100.0
+)
+
+// duEntry is an entry of the disk usage page, with its bar and treemap tile.
+type duEntry struct {
+	fs.DiskEntry
+	Href    string
+	Percent float64
+	Tile    *tile
+}
+
+// tile is a rectangle of the treemap, in percents of its width and height.
+type tile struct {
+	Left, Top, Width, Height float64
+}
+
+type duData struct {
+	page
+	*fs.DiskUsage
+	Breadcrumbs []helpers.Breadcrumb
+	Entries     []duEntry
+}
+
+// duHandler shows the largest files and directories under the directory at the URL path,
+// as bars and a treemap, or as JSON with ?json.
+func (s *server) duHandler(w http.ResponseWriter, r *http.Request, path string) {
+	setRoute(w, "du")
+	if s.fs.Sizes == nil {
+		// walking the whole tree on every request is what the background sizes avoid
+		s.notFoundHandler(w, r)
+		return
+	}
+	fullPath := s.fs.Join(path)
+
+	fd, err := s.fs.Stat(fullPath)
+	if err != nil || !fd.IsDir {
+		s.notFoundHandler(w, r)
+		return
+	}
+	if !s.checkPass(fd, w, r) {
+		return
+	}
+
+	du, err := s.fs.DiskUsage(fullPath)
+	if err != nil {
+		s.notFoundHandler(w, r)
+		return
+	}
+
+	if _, ok := r.URL.Query()["json"]; ok {
+		b, err := json.MarshalIndent(du, "", "  ")
+		if err != nil {
+			res := httpResponse{Error: true, Message: "couldn't encode disk usage"}
+			res.JSON(http.StatusInternalServerError, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := fmt.Fprint(w, string(b)); err != nil {
+			s.log.WithError(err).Error("couldn't print to response writer for disk usage")
+		}
+		return
+	}
+
+	links := s.linksOf(r)
+	duLinks := links.Under("_du")
+	data := duData{page: s.pageOf(r), DiskUsage: du, Breadcrumbs: duLinks.Breadcrumbs(du.Path, "")}
+
+	var sizes []float64
+	for _, e := range du.Entries {
+		entry := duEntry{DiskEntry: e, Href: links.Href(e.Path)}
+		if e.IsDir {
+			entry.Href = duLinks.Href(e.Path)
+		}
+		if du.Usage.Size > 0 {
+			entry.Percent = float64(e.Size) / float64(du.Usage.Size) * 100
+		}
+		data.Entries = append(data.Entries, entry)
+		if e.Size > 0 {
+			sizes = append(sizes, float64(e.Size))
+		}
+	}
+	// the entries are sorted by size, so the tiles match the first entries
+	for i, t := range treemap(sizes, treemapWidth, treemapHeight) {
+		data.Entries[i].Tile = &tile{
+			Left:   t.x / treemapWidth * 100,
+			Top:    t.y / treemapHeight * 100,
+			Width:  t.w / treemapWidth * 100,
+			Height: t.h / treemapHeight * 100,
+		}
+	}
+
+	s.templateHandler(w, r, http.StatusOK, "du", data)
+}
+
+type rect struct {
+	x, y, w, h float64
+}
+
+// treemap lays out the values, sorted from the largest, as rectangles filling a width by height area,
+// using the squarified algorithm to keep the rectangles close to squares.
+func treemap(values []float64, width, height float64) []rect {
+	rects := make([]rect, len(values))
+	total := sum(values)
+	if total <= 0 {
+		return rects
+	}
+
+	areas := make([]float64, len(values))
+	for i, v := range values {
+		areas[i] = v / total * width * height
+	}
+
+	free := rect{0, 0, width, height}
+	for i := 0; i < len(areas); {
+		side := free.w
+		if free.h < side {
+			side = free.h
+		}
+
+		// grow the row while it makes its rectangles more square
+		j := i + 1
+		for j < len(areas) && worst(areas[i:j+1], side) <= worst(areas[i:j], side) {
+			j++
+		}
+
+		row := sum(areas[i:j])
+		if free.w >= free.h {
+			// a column on the left
+			w := row / free.h
+			y := free.y
+			for k := i; k < j; k++ {
+				h := areas[k] / w
+				rects[k] = rect{free.x, y, w, h}
+				y += h
+			}
+			free.x, free.w = free.x+w, free.w-w
+		} else {
+			// a row on the top
+			h := row / free.w
+			x := free.x
+			for k := i; k < j; k++ {
+				w := areas[k] / h
+				rects[k] = rect{x, free.y, w, h}
+				x += w
+			}
+			free.y, free.h = free.y+h, free.h-h
+		}
+		i = j
+	}
+	return rects
+}
+
+// worst returns the worst aspect ratio of the rectangles of the row of areas, laid along side.
+func worst(row []float64, side float64) float64 {
+	s := sum(row)
+	max, min := row[0], row[0]
+	for _, v := range row {
+		if v > max {
+			max = v
+		}
+		if v < min {
+			min = v
+		}
+	}
+	a, b := side*side*max/(s*s), s*s/(side*side*min)
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func sum(values []float64) float64 {
+	var s float64
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"encoding/json"
+	"filekeep/fs"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTreemap(t *testing.T) {
+	values := []float64{6, 6, 4, 3, 2, 2, 1}
+	rects := treemap(values, 6, 4)
+
+	var area float64
+	for i, r := range rects {
+		if r.x < -1e-9 || r.y < -1e-9 || r.x+r.w > 6+1e-9 || r.y+r.h > 4+1e-9 {
+			t.Errorf("rectangle %d %+v is out of bounds", i, r)
+		}
+		if math.Abs(r.w*r.h-values[i]) > 1e-9 {
+			t.Errorf("expected rectangle %d to have area %g, got %g", i, values[i], r.w*r.h)
+		}
+		area += r.w * r.h
+	}
+	if math.Abs(area-24) > 1e-9 {
+		t.Errorf("expected the rectangles to fill the area, got %g", area)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	root := tempRoot(t, "small.txt", "big/a/b/deep.bin", ".hidden/secret.bin")
+	for name, size := range map[string]int{"big/a/b/deep.bin": 5000, ".hidden/secret.bin": 9000} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w := get(t, NewHandler(Options{Root: root}), "/_du/"); w.Code != 404 {
+		t.Errorf("expected the explorer to be off without the directory sizes, got %d", w.Code)
+	}
+	h := NewHandler(Options{Root: root, DirSizes: true})
+
+	var du fs.DiskUsage
+	for i := 0; i < 200 && (i == 0 || du.Usage.Pending); i++ {
+		time.Sleep(5 * time.Millisecond)
+		w := get(t, h, "/_du/?json")
+		du = fs.DiskUsage{}
+		if err := json.Unmarshal(w.Body.Bytes(), &du); err != nil {
+			t.Fatalf("%s: %q", err, w.Body.String())
+		}
+	}
+	if du.Usage.Size != 5009 || len(du.Entries) != 2 || du.Entries[0].Name != "big" || du.Entries[0].Size != 5000 {
+		t.Errorf("unexpected disk usage %+v", du)
+	}
+
+	w := get(t, h, "/_du/big")
+	for _, s := range []string{`href="/_du/big/a"`, `<a href="/_du/">~</a>/<a href="/_du/big">big</a>`, `class="tile -dir"`, "100.0%"} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("expected the page to contain %q", s)
+		}
+	}
+
+	for _, target := range []string{"/_du/small.txt", "/_du/.hidden", "/_du/missing"} {
+		if w := get(t, h, target); w.Code != 404 {
+			t.Errorf("expected %s to be not found, got %d", target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"encoding/json"
+	"filekeep/config"
+	"filekeep/watch"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// keepAlive is how often a comment is sent on idle event streams, so proxies don't close them.
+const keepAlive = 15 * time.Second
+
+// Events returns the directory watcher described by the config c, or nil if live updates are disabled.
+func Events(c *config.Config) *watch.Hub {
+	if !c.Events.Enabled {
+		return nil
+	}
+	return watch.New(c.Events.PollInterval)
+}
+
+// eventData is the data of a server-sent event, describing the changed file or directory.
+type eventData struct {
+	Name      string `json:"name"`
+	Href      string `json:"href,omitempty"`
+	IsDir     bool   `json:"is_dir,omitempty"`
+	IsArchive bool   `json:"is_archive,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	SizeText  string `json:"size_text,omitempty"`
+}
+
+// eventsHandler streams the changes in the directory at path as server-sent events, named after the operation:
+// create, modify or delete. Hidden files are left out.
+func (s *server) eventsHandler(w http.ResponseWriter, r *http.Request, path string) {
+	setRoute(w, "events")
+	if s.opts.Events == nil {
+		s.notFoundHandler(w, r)
+		return
+	}
+
+	dir := s.fs.Join(path)
+	n, err := s.fs.Stat(dir)
+	if err != nil || !n.IsDir {
+		s.notFoundHandler(w, r)
+		return
+	}
+	if _, ok := s.tokenAuth(r); n.Password != "" && !ok {
+		res := httpResponse{Error: true, Message: "live updates of protected directories need an API token"}
+		res.JSON(http.StatusUnauthorized, w)
+		return
+	}
+
+	events, cancel, err := s.opts.Events.Subscribe(dir)
+	if err != nil {
+		s.log.WithError(err).Errorf("couldn't watch %q", dir)
+		res := httpResponse{Error: true, Message: "couldn't watch directory"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+	defer cancel()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// nginx buffers responses by default
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(format string, args ...interface{}) bool {
+		// the stream lasts longer than the server's write timeout
+		rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	links := s.linksOf(r)
+	t := time.NewTicker(keepAlive)
+	defer t.Stop()
+	if !send("retry: %d\n\n", (5 * time.Second).Milliseconds()) {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.C:
+			if !send(": keep-alive\n\n") {
+				return
+			}
+		case e := <-events:
+			if s.fs.IsHidden(e.Path(), e.Name) {
+				continue
+			}
+
+			data := eventData{Name: e.Name}
+			if e.Op != watch.Delete {
+				n, err := s.fs.Stat(e.Path())
+				if err != nil {
+					// gone already, its deletion follows
+					continue
+				}
+				data = eventData{
+					Name:      n.Name,
+					Href:      links.Href(n.Path),
+					IsDir:     n.IsDir,
+					IsArchive: n.IsArchive,
+					SizeText:  n.Size.String(),
+					Size:      int64(n.Size),
+				}
+			}
+
+			b, _ := json.Marshal(data)
+			if !send("event: %s\ndata: %s\n\n", e.Op, b) {
+				return
+			}
+		}
+	}
+}
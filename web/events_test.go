@@ -0,0 +1,87 @@
+package web
+
+import (
+	"bufio"
+	"filekeep/watch"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	root := tempRoot(t, "docs/a.txt")
+	hub := watch.New(10 * time.Millisecond)
+	defer hub.Close()
+	server := httptest.NewServer(NewHandler(Options{Root: root, Events: hub}))
+	defer server.Close()
+
+	if res := get(t, server.Config.Handler, "/docs"); !strings.Contains(res.Body.String(), `new EventSource("/_events/docs")`) {
+		t.Error("expected the listing to subscribe to its live updates")
+	}
+
+	res, err := http.Get(server.URL + "/_events/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", res.StatusCode, ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		s := bufio.NewScanner(res.Body)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		close(lines)
+	}()
+	// event returns the next event, skipping the modifications
+	event := func() (string, string) {
+		var name, data string
+		for {
+			select {
+			case line := <-lines:
+				switch {
+				case strings.HasPrefix(line, "event: "):
+					name = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					data = strings.TrimPrefix(line, "data: ")
+				case line == "" && name == "modify":
+					name = ""
+				case line == "" && name != "":
+					return name, data
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("no event")
+			}
+		}
+	}
+
+	// the handler subscribes after sending the headers
+	time.Sleep(50 * time.Millisecond)
+	for _, name := range []string{".hidden", "b.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(root, "docs", name), []byte("bb"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if name, data := event(); name != "create" || !strings.Contains(data, `"name":"b.txt","href":"/docs/b.txt"`) || !strings.Contains(data, `"size":2`) {
+		t.Errorf("expected the creation of b.txt, got %s %s", name, data)
+	}
+
+	if err := os.Remove(filepath.Join(root, "docs", "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if name, data := event(); name != "delete" || data != `{"name":"a.txt"}` {
+		t.Errorf("expected the deletion of a.txt, got %s %s", name, data)
+	}
+
+	if res := get(t, server.Config.Handler, "/_events/missing"); res.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing directory, got %d", res.Code)
+	}
+}
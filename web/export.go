@@ -0,0 +1,270 @@
+package web
+
+import (
+	"encoding/json"
+	"filekeep/fs"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportManifest is the file of an export directory keeping the version of every exported listing.
+const exportManifest = ".filekeep-export.json"
+
+// ExportOptions configures a static export.
+type ExportOptions struct {
+	// Out is the directory the pages and files are written to.
+	Out string
+	// Link hard links the files instead of copying them, copying them anyway across devices.
+	Link bool
+}
+
+// ExportStats counts the work of an export.
+type ExportStats struct {
+	// Dirs is the number of directories written, Unchanged the number of those skipped.
+	Dirs, Unchanged int
+	// Files is the number of files copied or linked, Removed the number of files and directories
+	// removed since the last export.
+	Files, Removed int
+}
+
+// Export writes a static mirror of the files described by opts into eo.Out, with an index.html listing
+// for every directory, rendered by the same templates. Hidden files, and protected files and directories,
+// are left out, and the links needing the server aren't shown. Directories unchanged since the previous
+// export into the same directory are skipped.
+func Export(opts Options, eo ExportOptions) (ExportStats, error) {
+	opts.DirSizes, opts.Archives, opts.Events, opts.Feeds, opts.Index = false, nil, nil, false, nil
+	s := newServer(opts)
+	s.static = true
+
+	out, err := filepath.Abs(eo.Out)
+	if err != nil {
+		return ExportStats{}, fmt.Errorf("couldn't find the export directory: %s", err)
+	}
+	roots := []string{s.fs.Root}
+	for _, m := range s.fs.Mounts {
+		roots = append(roots, m.Path)
+	}
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return ExportStats{}, fmt.Errorf("couldn't find the root directory: %s", err)
+		}
+		if out == root || strings.HasPrefix(out, root+string(filepath.Separator)) {
+			return ExportStats{}, fmt.Errorf("couldn't export into %q, it's inside the root directory or a mount", eo.Out)
+		}
+	}
+
+	e := &exporter{s: s, opts: eo, versions: make(map[string]string)}
+	if b, err := ioutil.ReadFile(filepath.Join(eo.Out, exportManifest)); err == nil {
+		if err := json.Unmarshal(b, &e.previous); err != nil {
+			s.log.WithError(err).Warn("ignoring the manifest of the previous export")
+		}
+	}
+
+	if err := os.MkdirAll(eo.Out, 0755); err != nil {
+		return e.stats, fmt.Errorf("couldn't create export directory: %s", err)
+	}
+	if err := e.assets(); err != nil {
+		return e.stats, err
+	}
+	if err := e.dir(s.fs.Root, eo.Out); err != nil {
+		return e.stats, err
+	}
+
+	b, err := json.MarshalIndent(e.versions, "", "  ")
+	if err != nil {
+		return e.stats, fmt.Errorf("couldn't encode export manifest: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(eo.Out, exportManifest), b, 0644); err != nil {
+		return e.stats, fmt.Errorf("couldn't write export manifest: %s", err)
+	}
+	return e.stats, nil
+}
+
+type exporter struct {
+	s    *server
+	opts ExportOptions
+	// previous and versions map the exported directories to the versions of their listings,
+	// as of the previous export and this one
+	previous, versions map[string]string
+	stats              ExportStats
+}
+
+// assets writes the stylesheets and the about page, linked by every page.
+func (e *exporter) assets() error {
+	dir := filepath.Join(e.opts.Out, "_assets")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("couldn't create assets directory: %s", err)
+	}
+	for _, sheet := range stylesheets {
+		if err := ioutil.WriteFile(filepath.Join(e.opts.Out, filepath.FromSlash(sheet.Path)), []byte(sheet.content), 0644); err != nil {
+			return fmt.Errorf("couldn't write stylesheet: %s", err)
+		}
+	}
+	return e.page(filepath.Join(e.opts.Out, "about"), "about", page{s: e.s, links: e.s.links})
+}
+
+// page renders the template name with data into the index.html of dir.
+func (e *exporter) page(dir, name string, data interface{}) error {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		return err
+	}
+	buffer, err := e.s.render(r, name, data)
+	if err != nil {
+		return fmt.Errorf("couldn't render %s page: %s", name, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("couldn't create directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("couldn't write page: %s", err)
+	}
+	return nil
+}
+
+// dir exports the directory at path into out, then its subdirectories.
+func (e *exporter) dir(path, out string) error {
+	n, err := e.s.fs.Read(path)
+	if err != nil || n.Password != "" {
+		return nil
+	}
+	n.Files, n.Dirs = unprotected(n.Files), unprotected(n.Dirs)
+	n.FilesSize = 0
+	for _, f := range n.Files {
+		n.FilesSize += f.Size
+	}
+
+	rel := filepath.ToSlash(n.Path)
+	version := e.version(n)
+	e.versions[rel] = version
+	_, err = os.Stat(filepath.Join(out, "index.html"))
+	if e.previous[rel] == version && err == nil {
+		e.stats.Unchanged++
+	} else {
+		if err := e.update(path, out, n); err != nil {
+			return err
+		}
+		e.stats.Dirs++
+	}
+
+	for _, d := range n.Dirs {
+		if err := e.dir(e.s.fs.Join(d.Path), filepath.Join(out, d.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update writes the listing and the files of the directory n at path into out, and removes what
+// isn't there anymore. A file named index.html takes the place of the listing.
+func (e *exporter) update(path, out string, n *fs.Node) error {
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return fmt.Errorf("couldn't create directory: %s", err)
+	}
+
+	keep := map[string]bool{"index.html": true}
+	if n.Path == "." {
+		keep["_assets"], keep["about"], keep[exportManifest] = true, true, true
+	}
+	hasIndex := false
+	for _, f := range n.Files {
+		keep[f.Name] = true
+		hasIndex = hasIndex || f.Name == "index.html"
+		if err := e.file(filepath.Join(path, f.Name), filepath.Join(out, f.Name)); err != nil {
+			return err
+		}
+	}
+	for _, d := range n.Dirs {
+		keep[d.Name] = true
+	}
+
+	entries, err := ioutil.ReadDir(out)
+	if err != nil {
+		return fmt.Errorf("couldn't list export directory: %s", err)
+	}
+	for _, entry := range entries {
+		if keep[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(out, entry.Name())); err != nil {
+			return fmt.Errorf("couldn't remove %q: %s", entry.Name(), err)
+		}
+		e.stats.Removed++
+	}
+
+	if hasIndex {
+		return nil
+	}
+	return e.page(out, "list", nodePage{n, page{s: e.s, links: e.s.links}})
+}
+
+// file copies or links the file at path to dst, unless it's up to date.
+func (e *exporter) file(path, dst string) error {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	if d, err := os.Stat(dst); err == nil {
+		if os.SameFile(info, d) || (!e.opts.Link && d.Size() == info.Size() && d.ModTime().Equal(info.ModTime())) {
+			return nil
+		}
+		// never write through a previous hard link
+		if err := os.Remove(dst); err != nil {
+			return fmt.Errorf("couldn't remove %q: %s", dst, err)
+		}
+	}
+
+	e.stats.Files++
+	if e.opts.Link {
+		if err := os.Link(path, dst); err == nil {
+			return nil
+		}
+		e.s.log.Debugf("couldn't link %q, copying it instead", path)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("couldn't open %q: %s", path, err)
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("couldn't create %q: %s", dst, err)
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return fmt.Errorf("couldn't copy %q: %s", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("couldn't copy %q: %s", path, err)
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// version returns the version of the exported listing of n, changing with its entries, the templates
+// and the options rendering it.
+func (e *exporter) version(n *fs.Node) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%d\x00%t\x00%s\x00",
+		n.Version(), templatesVersion, e.s.links.Prefix,
+		strings.Join(e.s.opts.Headers, "/"), strings.Join(e.s.opts.Footers, "/"), e.s.opts.ReadmeMaxSize, e.opts.Link, e.s.opts.Theme)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// unprotected returns the nodes without a password.
+func unprotected(nodes []*fs.Node) []*fs.Node {
+	var kept []*fs.Node
+	for _, n := range nodes {
+		if n.Password == "" {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
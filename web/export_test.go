@@ -0,0 +1,72 @@
+package web
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	root := tempRoot(t, "a.txt", "docs/b.txt", "docs/deep/c.txt", "site/index.html", "locked/secret.txt", ".hidden")
+	sum := md5.Sum([]byte("pass"))
+	if err := ioutil.WriteFile(filepath.Join(root, ".locked"), []byte(fmt.Sprintf("%x\n", sum)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(tempRoot(t), "out")
+	opts := Options{Root: root, Prefix: "/mirror"}
+
+	stats, err := Export(opts, ExportOptions{Out: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Dirs != 4 || stats.Files != 4 {
+		t.Errorf("unexpected stats of the first export %+v", stats)
+	}
+	for _, name := range []string{"a.txt", "docs/deep/c.txt", "site/index.html", "_assets/custom.css", "about/index.html"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("expected %s to be exported: %s", name, err)
+		}
+	}
+	for _, name := range []string{"locked", ".hidden"} {
+		if _, err := os.Stat(filepath.Join(out, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be left out", name)
+		}
+	}
+	page, _ := ioutil.ReadFile(filepath.Join(out, "docs", "index.html"))
+	for _, s := range []string{`href="/mirror/docs/b.txt"`, `href="/mirror/docs/deep"`, "1 file"} {
+		if !strings.Contains(string(page), s) {
+			t.Errorf("expected the listing to contain %q", s)
+		}
+	}
+	for _, s := range []string{"_du", "_toggleTheme", "locked"} {
+		if strings.Contains(string(page), s) {
+			t.Errorf("expected the listing not to contain %q", s)
+		}
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(out, "site", "index.html")); string(b) != "site/index.html" {
+		t.Errorf("expected the index file to replace the listing, got %q", b)
+	}
+
+	if err := os.Remove(filepath.Join(root, "docs", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	// the root lists the count of files of docs too
+	stats, err = Export(opts, ExportOptions{Out: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Dirs != 2 || stats.Unchanged != 2 || stats.Files != 0 || stats.Removed != 1 {
+		t.Errorf("unexpected stats of the second export %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(out, "docs", "b.txt")); !os.IsNotExist(err) {
+		t.Error("expected the deleted file to be removed")
+	}
+
+	if _, err := Export(opts, ExportOptions{Out: filepath.Join(root, "out")}); err == nil {
+		t.Error("expected exporting inside the root to fail")
+	}
+}
@@ -0,0 +1,194 @@
+package web
+
+import (
+	"encoding/xml"
+	"filekeep/fs"
+	"filekeep/helpers"
+	"fmt"
+	"hash/fnv"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// atomFeed is an Atom feed, as of RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+// rssFeed is a RSS 2.0 feed.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Description string       `xml:"description"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// feedEntry is a file listed in a feed.
+type feedEntry struct {
+	title string
+	url   string
+	// id changes along with the file, so rebuilt files show up again
+	id   string
+	node *fs.Node
+	mime string
+}
+
+// feedHandler serves the most recent files under the directory n at path, as an Atom or RSS feed.
+func (s *server) feedHandler(w http.ResponseWriter, r *http.Request, path string, n *fs.Node, kind string) {
+	setRoute(w, "feed")
+	if !s.opts.Feeds || !n.IsDir || n.InArchive() {
+		s.notFoundHandler(w, r)
+		return
+	}
+	if kind != "atom" && kind != "rss" {
+		res := httpResponse{Error: true, Message: "unknown feed type, use atom or rss"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+
+	files, err := s.fs.Recent(path, s.opts.FeedDepth, s.opts.FeedLimit)
+	if err != nil {
+		s.notFoundHandler(w, r)
+		return
+	}
+
+	base := helpers.BaseURL(r, s.opts.TrustedProxies)
+	links := s.linksOf(r)
+	dirURL := base + links.Href(n.Path)
+	dir := filepath.Join("/", n.Path)
+	title := "filekeep: " + filepath.ToSlash(dir)
+
+	updated := n.ModTime
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00", kind, dirURL)
+	entries := make([]feedEntry, len(files))
+	for i, f := range files {
+		if f.ModTime.After(updated) {
+			updated = f.ModTime
+		}
+		rel, _ := filepath.Rel(dir, filepath.Join("/", f.Path))
+		url := base + links.Href(f.Path)
+		entries[i] = feedEntry{
+			title: filepath.ToSlash(rel),
+			url:   url,
+			id:    fmt.Sprintf("%s#%d", url, f.ModTime.Unix()),
+			node:  f,
+			mime:  mime.TypeByExtension(filepath.Ext(f.Name)),
+		}
+		if entries[i].mime == "" {
+			entries[i].mime = "application/octet-stream"
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", f.Path, f.ModTime.UnixNano(), f.Size)
+	}
+	if notModified(w, r, fmt.Sprintf(`W/"%x"`, h.Sum64()), updated) {
+		setRoute(w, "not_modified")
+		return
+	}
+
+	var feed interface{}
+	if kind == "atom" {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		atom := atomFeed{
+			ID:      dirURL,
+			Title:   title,
+			Updated: updated.UTC().Format(time.RFC3339),
+			Author:  "filekeep",
+			Links: []atomLink{
+				{Href: base + r.URL.RequestURI(), Rel: "self", Type: "application/atom+xml"},
+				{Href: dirURL, Rel: "alternate", Type: "text/html"},
+			},
+		}
+		for _, e := range entries {
+			atom.Entries = append(atom.Entries, atomEntry{
+				ID:      e.id,
+				Title:   e.title,
+				Updated: e.node.ModTime.UTC().Format(time.RFC3339),
+				Summary: e.node.Size.String(),
+				Links: []atomLink{
+					{Href: e.url, Rel: "alternate"},
+					{Href: e.url, Rel: "enclosure", Type: e.mime, Length: int64(e.node.Size)},
+				},
+			})
+		}
+		feed = atom
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		rss := rssFeed{Version: "2.0", Channel: rssChannel{
+			Title:         title,
+			Link:          dirURL,
+			Description:   "The latest files in " + filepath.ToSlash(dir),
+			LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+		}}
+		for _, e := range entries {
+			rss.Channel.Items = append(rss.Channel.Items, rssItem{
+				Title:       e.title,
+				Link:        e.url,
+				GUID:        rssGUID{Value: e.id},
+				PubDate:     e.node.ModTime.UTC().Format(time.RFC1123Z),
+				Description: e.node.Size.String(),
+				Enclosure:   rssEnclosure{URL: e.url, Length: int64(e.node.Size), Type: e.mime},
+			})
+		}
+		feed = rss
+	}
+
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		s.log.WithError(err).Error("couldn't encode feed")
+		res := httpResponse{Error: true, Message: "couldn't encode feed"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+	fmt.Fprint(w, xml.Header+strings.TrimSpace(string(b))+"\n")
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFeeds(t *testing.T) {
+	root := tempRoot(t, "old.txt", "new.txt", "sub/mid.txt", "sub/a/b/deep.txt", "locked/secret.txt", ".hidden.txt")
+	sum := md5.Sum([]byte("pass"))
+	if err := ioutil.WriteFile(filepath.Join(root, ".locked"), []byte(fmt.Sprintf("%x\n", sum)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, name := range []string{"old.txt", "sub/mid.txt", "new.txt"} {
+		mtime := now.Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewHandler(Options{Root: root, Feeds: true, FeedDepth: 2, FeedLimit: 10})
+
+	w := get(t, h, "/?feed=atom")
+	if ct := w.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	var atom atomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &atom); err != nil {
+		t.Fatalf("%s: %q", err, w.Body.String())
+	}
+	var titles []string
+	for _, e := range atom.Entries {
+		titles = append(titles, e.Title)
+	}
+	if fmt.Sprint(titles) != "[new.txt sub/mid.txt old.txt]" {
+		t.Errorf("unexpected entries %v", titles)
+	}
+	if len(atom.Entries) > 0 && atom.Entries[0].Links[0].Href != "http://example.com/new.txt" {
+		t.Errorf("unexpected link %+v", atom.Entries[0].Links)
+	}
+
+	w = get(t, h, "/sub?feed=rss")
+	var rss rssFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &rss); err != nil {
+		t.Fatalf("%s: %q", err, w.Body.String())
+	}
+	if items := rss.Channel.Items; len(items) != 2 || items[0].Title != "a/b/deep.txt" || items[0].Enclosure.Length != int64(len("sub/a/b/deep.txt")) {
+		t.Errorf("unexpected items %+v", items)
+	}
+
+	for target, code := range map[string]int{"/?feed=json": 400, "/old.txt?feed=atom": 404, "/locked?feed=atom": 401} {
+		if w := get(t, h, target); w.Code != code {
+			t.Errorf("expected %s to answer %d, got %d", target, code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"filekeep/config"
+	"filekeep/guard"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GuardPolicy converts the lockout policy of the config to a guard.Policy.
+func GuardPolicy(p config.LockoutPolicy) guard.Policy {
+	return guard.Policy{
+		Attempts:   p.Attempts,
+		Lockout:    p.Lockout,
+		MaxLockout: p.MaxLockout,
+		ResetAfter: p.ResetAfter,
+	}
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// tooManyAttempts responds with 429 Too Many Requests after too many wrong passwords.
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	tooManyRequests(w, "locked_out", "too many wrong passwords", wait)
+}
+
+// tooManyRequests responds with 429 Too Many Requests on the route, telling the client when to retry.
+func tooManyRequests(w http.ResponseWriter, route, message string, wait time.Duration) {
+	setRoute(w, route)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	res := httpResponse{Error: true, Message: message + ", retry in " + wait.Round(time.Second).String()}
+	res.JSON(http.StatusTooManyRequests, w)
+}
+
+type lockoutsData struct {
+	page
+	Now    time.Time
+	Guards map[string][]guard.Status
+}
+
+// lockoutsHandler shows the tracked failures and lockouts, as a page or as JSON with ?json.
+func (s *server) lockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	setRoute(w, "lockouts")
+	data := lockoutsData{
+		page: s.pageOf(r),
+		Now:  time.Now(),
+		Guards: map[string][]guard.Status{
+			"client": s.opts.IPGuard.Snapshot(),
+			"path":   s.opts.PathGuard.Snapshot(),
+		},
+	}
+
+	if _, ok := r.URL.Query()["json"]; ok {
+		res := httpResponse{Raw: data.Guards}
+		res.JSON(http.StatusOK, w)
+		return
+	}
+	s.templateHandler(w, r, http.StatusOK, "lockouts", data)
+}
+
+// NewAdminHandler returns a http.Handler for the administrative endpoints: /metrics if opts.Metrics
+// is set, /lockouts and /webhooks. It does no authentication nor rate limiting, so it should only be reachable
+// by administrators.
+func NewAdminHandler(opts Options) http.Handler {
+	opts.Prefix = ""
+	opts.RateLimit, opts.Bandwidth = nil, nil
+	s := NewHandler(opts).(*server)
+
+	mux := http.NewServeMux()
+	if opts.Metrics {
+		mux.Handle("/metrics", s)
+	}
+	mux.Handle("/lockouts", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.instrument(w, r, s.lockoutsHandler)
+	}))
+	mux.Handle("/webhooks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.instrument(w, r, s.webhooksHandler)
+	}))
+	return mux
+}
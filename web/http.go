@@ -5,45 +5,367 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"filekeep/assets/css"
 	"filekeep/assets/images"
-	"filekeep/assets/templates"
+	"filekeep/audit"
 	"filekeep/config"
 	"filekeep/fs"
+	"filekeep/guard"
 	"filekeep/helpers"
+	"filekeep/jobs"
+	"filekeep/metrics"
+	"filekeep/ratelimit"
+	"filekeep/watch"
+	"filekeep/webhook"
 	"fmt"
-	"html/template"
+	"io"
+	"net"
 	"net/http"
+	pathpkg "path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 )
 
-// NewServer returns a new http.Server after setting the routes.
-func NewServer() *http.Server {
+// Options configures the handler returned by NewHandler.
+type Options struct {
+	// Root is the directory being served. Defaults to ".", the runtime dir.
+	Root string
+	// HideRules decide which files and directories are hidden.
+	HideRules config.HideRules
+	// Mounts are the other directories served as top-level directories of the root, with their own
+	// hide rules, and maybe read-only.
+	Mounts []config.Mount
+	// Prefix is the URL path the handler is mounted at, e.g. "/files". Requests outside of it
+	// are not found, and all generated links start with it. Defaults to the root, "/".
+	// Requests of the TrustedProxies carrying a X-Forwarded-Prefix header use it for their links
+	// instead, and are expected to have had the prefix stripped by the proxy.
+	Prefix string
+	// Tokens maps API token names to their secret values.
+	Tokens map[string]string
+	// UploadMaxSize is the size in bytes up to which uploads are accepted, 0 for any size.
+	UploadMaxSize int64
+	// Theme is the theme of the listings until toggled by the visitor, "dark" or else the light one.
+	Theme string
+	// Sites maps host names to the sites served for the requests to them instead, selected by the Host
+	// header. The requests to the other hosts are served the files of these options.
+	Sites map[string]Site
+	// Metrics serves the Prometheus metrics at /metrics, shadowing any file with that name.
+	Metrics bool
+	// AccessLog receives a line for every request, if set.
+	AccessLog io.Writer
+	// AccessLogFormat is either "combined", the Apache combined log format, or "json".
+	AccessLogFormat string
+	// TrustedProxies are the networks of reverse proxies, whose X-Forwarded-For header is trusted
+	// to find out the client address.
+	TrustedProxies []*net.IPNet
+	// Audit records security relevant events, like password attempts, uploads and deletions, if set.
+	Audit *audit.Log
+	// Webhooks notifies the webhooks of uploads, deletions and moves, if set. Left for the caller to set.
+	Webhooks *webhook.Dispatcher
+	// IPGuard and PathGuard lock out client addresses and protected paths after too many wrong
+	// passwords. Nil disables the lockouts.
+	IPGuard, PathGuard *guard.Guard
+	// RateLimit limits the requests of each client address. Nil disables the limit.
+	RateLimit *ratelimit.Keyed
+	// Bandwidth caps the download bandwidth of files. Nil disables the caps.
+	Bandwidth *ratelimit.Bandwidth
+	// CacheControl maps URL path prefixes to the Cache-Control header of the files and listings
+	// under them. The longest matching prefix wins.
+	CacheControl map[string]string
+	// Compression compresses the responses. Nil disables the compression.
+	Compression *Compression
+	// DirSizes computes the recursive sizes of directories in the background, computed again after
+	// DirSizesMaxAge.
+	DirSizes       bool
+	DirSizesMaxAge time.Duration
+	// ChecksumCacheSize is the number of file checksums cached.
+	ChecksumCacheSize int
+	// DigestMaxSize is the size in bytes up to which downloads get a Repr-Digest header computed for them,
+	// 0 for none. Other files only get it once their SHA-256 is cached, or if the client asks for it.
+	DigestMaxSize int64
+	// Archives browses inside ZIP and tar archives within its limits. Nil disables the browsing.
+	Archives *fs.Archives
+	// Jobs runs the extraction and compression of archives requested through the API, writing up to
+	// JobLimits each. Nil disables them.
+	Jobs      *jobs.Manager
+	JobLimits fs.Limits
+	// Headers and Footers are the names of the files rendered above and below the listings, the first
+	// one found in a directory wins, if not bigger than ReadmeMaxSize.
+	Headers, Footers []string
+	ReadmeMaxSize    int64
+	// Index maps URL path prefixes to whether index.html is served instead of the listing of the
+	// directories under them, the longest matching prefix wins.
+	Index map[string]bool
+	// Feeds serves the FeedLimit most recent files under directories, looking FeedDepth levels deep,
+	// as Atom or RSS feeds.
+	Feeds                bool
+	FeedDepth, FeedLimit int
+	// Events watches the listed directories for their live updates. Nil disables the live updates.
+	Events *watch.Hub
+	// Logger receives errors and debugging output. Defaults to the logrus standard logger.
+	Logger logrus.FieldLogger
+}
+
+// OptionsFromConfig returns the Options described by the config c. The access log isn't opened,
+// and is left for the caller to set.
+func OptionsFromConfig(c *config.Config) Options {
+	trusted, err := helpers.ParseNets(c.TrustedProxies)
+	if err != nil {
+		logrus.WithError(err).Warn("ignoring trusted proxies")
+	}
+
+	return Options{
+		Root:      c.Root,
+		HideRules: c.HideRules,
+		Mounts:    c.Mounts,
+		Prefix:    c.Web.BasePath,
+		Tokens:    c.Tokens,
+		Theme:     c.Theme,
+		Sites:     Sites(c),
+		Metrics:   c.Metrics && c.Admin.Port == 0,
+
+		AccessLogFormat: c.AccessLog.Format,
+		TrustedProxies:  trusted,
+
+		IPGuard:   guard.New(GuardPolicy(c.BruteForce.IP)),
+		PathGuard: guard.New(GuardPolicy(c.BruteForce.Path)),
+
+		RateLimit: RateLimit(c),
+		Bandwidth: Bandwidth(c),
+
+		CacheControl: c.CacheControl,
+		Compression:  CompressionFromConfig(c),
+
+		DirSizes:       c.DirSizes.Enabled,
+		DirSizesMaxAge: c.DirSizes.MaxAge,
+
+		ChecksumCacheSize: c.Checksums.CacheSize,
+		DigestMaxSize:     int64(c.Checksums.DigestMaxSize),
+
+		Archives: Archives(c),
+
+		UploadMaxSize: int64(c.UploadMaxSize),
+
+		Jobs:      Jobs(c),
+		JobLimits: fs.Limits{MaxSize: int64(c.Jobs.MaxSize), MaxFiles: c.Jobs.MaxFiles},
+
+		Headers:       readmeNames(c, c.Readme.Header),
+		Footers:       readmeNames(c, c.Readme.Footer),
+		ReadmeMaxSize: int64(c.Readme.MaxSize),
+		Index:         c.Readme.Index,
+
+		Feeds:     c.Feeds.Enabled,
+		FeedDepth: c.Feeds.Depth,
+		FeedLimit: c.Feeds.Limit,
+
+		Events: Events(c),
+	}
+}
+
+// Archives returns the archive browsing described by the config c, or nil if it's disabled.
+func Archives(c *config.Config) *fs.Archives {
+	if !c.Archives.Enabled {
+		return nil
+	}
+	return fs.NewArchives(int64(c.Archives.MaxSize), c.Archives.MaxMembers, int64(c.Archives.MaxMemberSize))
+}
+
+type server struct {
+	opts   Options
+	fs     *fs.FS
+	links  helpers.Links
+	log    logrus.FieldLogger
+	access *accessLog
+	sums   *fs.Checksums
+	router *httprouter.Router
+	// sites are the servers of the sites by host name, sharing the access log
+	sites map[string]*server
+	// host is the host name of the site served, empty for the main one
+	host string
+	// static renders the pages of a static export, without the links needing the server
+	static bool
+}
+
+// NewHandler returns a http.Handler serving the files described by opts, independent of the global config.
+func NewHandler(opts Options) http.Handler {
+	s := newHandler(opts)
+	if len(opts.Sites) > 0 {
+		s.sites = make(map[string]*server, len(opts.Sites))
+		for host, site := range opts.Sites {
+			siteOpts := opts.Site(site)
+			if opts.Jobs != nil {
+				// the token holders of a site only see the jobs of the site
+				siteOpts.Jobs = opts.Jobs.Scope(hostName(host))
+			}
+			h := newHandler(siteOpts)
+			h.access = s.access
+			h.host = hostName(host)
+			s.sites[h.host] = h
+		}
+	}
+	return s
+}
+
+// newHandler returns the server described by opts, with its routes, ignoring the sites.
+func newHandler(opts Options) *server {
+	s := newServer(opts)
+
 	r := httprouter.New()
 
-	r.NotFound = http.HandlerFunc(notFoundHandler)
-	r.MethodNotAllowed = http.HandlerFunc(notFoundHandler)
-	r.PanicHandler = panicHandler
+	r.NotFound = http.HandlerFunc(s.notFoundHandler)
+	r.MethodNotAllowed = http.HandlerFunc(s.notFoundHandler)
+	r.PanicHandler = s.panicHandler
+
+	r.GET("/*path", s.pathHandler)
+	r.POST("/*path", s.pathHandler)
+	r.PUT("/*path", s.uploadHandler)
+	r.DELETE("/*path", s.deleteHandler)
+	r.Handle("MOVE", "/*path", s.moveHandler)
+
+	s.router = r
+	return s
+}
+
+// newServer returns the server described by opts, without its routes.
+func newServer(opts Options) *server {
+	if opts.Logger == nil {
+		opts.Logger = logrus.StandardLogger()
+	}
+	opts.Prefix = helpers.CleanPrefix(opts.Prefix)
+
+	s := &server{
+		opts:  opts,
+		fs:    fs.New(opts.Root, opts.HideRules, opts.Logger),
+		log:   opts.Logger,
+		links: helpers.Links{Root: opts.Root, Mounts: opts.Mounts, Prefix: opts.Prefix},
 
-	r.GET("/*path", pathHandler)
-	r.POST("/*path", pathHandler)
+		access: newAccessLog(opts.AccessLog, opts.AccessLogFormat),
+		sums:   fs.NewChecksums(opts.ChecksumCacheSize),
+	}
+	s.opts.Root = s.fs.Root
+	if opts.DirSizes {
+		s.fs.Sizes = fs.NewSizes(s.fs, opts.DirSizesMaxAge)
+	}
+	s.fs.Archives = opts.Archives
+	s.fs.Mounts = opts.Mounts
+	s.links.Root = s.fs.Root
+	return s
+}
+
+// NewServer returns a new http.Server serving the global config, after setting the routes.
+func NewServer() *http.Server {
+	c := config.Get()
+	return NewHTTPServer(c.Web.String(), NewHandler(OptionsFromConfig(c)))
+}
 
-	web := config.Get().Web
+// NewHTTPServer returns a new http.Server listening on addr, with sane timeouts.
+func NewHTTPServer(addr string, h http.Handler) *http.Server {
 	return &http.Server{
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 10 * time.Second,
-		WriteTimeout:      30 * time.Second,
+		WriteTimeout:      writeTimeout,
 		IdleTimeout:       120 * time.Second,
-		Handler:           r,
-		Addr:              web.String(),
+		Handler:           h,
+		Addr:              addr,
 	}
 }
 
+type contextKey string
+
+const linksKey contextKey = "links"
+
+// ServeHTTP selects the site of the request, strips the prefix from the request path, and routes the request.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := s.siteOf(r)
+	site.instrument(w, r, func(w http.ResponseWriter, r *http.Request) {
+		site.compress(w, r, site.serveHTTP)
+	})
+}
+
+func (s *server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	links := s.links
+	path := r.URL.Path
+
+	if prefix := s.forwardedPrefix(r); prefix != "" {
+		// the proxy already stripped its prefix, but might have kept ours
+		links.Prefix = prefix
+		if trimmed, ok := trimPrefix(path, s.opts.Prefix); ok {
+			path = trimmed
+		}
+	} else if s.opts.Prefix != "" {
+		trimmed, ok := trimPrefix(path, s.opts.Prefix)
+		if !ok {
+			s.notFoundHandler(w, r)
+			return
+		}
+		path = trimmed
+	}
+
+	u := *r.URL
+	if path != u.Path {
+		u.Path, u.RawPath = path, ""
+	}
+	r2 := r.WithContext(context.WithValue(r.Context(), linksKey, links))
+	r2.URL = &u
+
+	if !s.allowRequest(w, r2) {
+		return
+	}
+
+	if s.opts.Metrics && path == "/metrics" {
+		setRoute(w, "metrics")
+		metrics.Handler().ServeHTTP(w, r2)
+		return
+	}
+
+	s.router.ServeHTTP(w, r2)
+}
+
+// trimPrefix removes the prefix from the URL path, and returns whether path was under it.
+func trimPrefix(path, prefix string) (string, bool) {
+	if prefix == "" {
+		return path, true
+	}
+	trimmed := strings.TrimPrefix(path, prefix)
+	if len(trimmed) == len(path) || (trimmed != "" && trimmed[0] != '/') {
+		return path, false
+	}
+	if trimmed == "" {
+		trimmed = "/"
+	}
+	return trimmed, true
+}
+
+// forwardedPrefix returns the cleaned X-Forwarded-Prefix header sent by a trusted reverse proxy, if any.
+// It's ignored from anyone else, who could otherwise escape the prefix or poison the links cached for others.
+func (s *server) forwardedPrefix(r *http.Request) string {
+	if !helpers.FromTrustedProxy(r, s.opts.TrustedProxies) {
+		return ""
+	}
+	prefix := r.Header.Get("X-Forwarded-Prefix")
+	if i := strings.IndexByte(prefix, ','); i >= 0 {
+		prefix = prefix[:i]
+	}
+	return helpers.CleanPrefix(strings.TrimSpace(prefix))
+}
+
+// clientIP returns the address of the client, trusting the X-Forwarded-For header of trusted proxies.
+func (s *server) clientIP(r *http.Request) string {
+	return helpers.ClientIP(r, s.opts.TrustedProxies)
+}
+
+// linksOf returns the links builder for the request, aware of its forwarded prefix.
+func (s *server) linksOf(r *http.Request) helpers.Links {
+	if links, ok := r.Context().Value(linksKey).(helpers.Links); ok {
+		return links
+	}
+	return s.links
+}
+
 type httpResponse struct {
 	Error   bool        `json:"error,omitempty"`
 	Message string      `json:"message,omitempty"`
@@ -69,58 +391,33 @@ func (r *httpResponse) JSON(code int, w http.ResponseWriter) {
 }
 
 type staticData struct {
-	CSS       template.CSS
-	DarkTheme bool
+	page
+	Stylesheets []stylesheet
+	DarkTheme   bool
+	// Static leaves out the links needing the server, in static exports.
+	Static bool
 }
 
 var headerData = staticData{
-	CSS: template.CSS(css.HackCSS + css.HackDarkCSS + css.CustomCSS),
-}
-
-var funcMap = template.FuncMap{
-	"breadcrumbs": helpers.Breadcrumbs,
-	"href":        helpers.Href,
+	Stylesheets: stylesheets,
 }
 
-func panicHandler(w http.ResponseWriter, r *http.Request, i interface{}) {
-	logrus.Errorf("caught panic on %s %q: %v", r.Method, r.URL.Path, i)
+func (s *server) panicHandler(w http.ResponseWriter, r *http.Request, i interface{}) {
+	setRoute(w, "panic")
+	s.log.Errorf("caught panic on %s %q: %v", r.Method, r.URL.Path, i)
 	res := httpResponse{true, "caught panic", i}
 	res.JSON(http.StatusInternalServerError, w)
 }
 
-func notFoundHandler(w http.ResponseWriter, r *http.Request) {
-	pageIncomplete := false
-	headerDataCopy := &headerData
-	headerDataCopy.DarkTheme = r.Context().Value("dark-theme").(bool)
-	buffer := bytes.NewBufferString("")
-
-	if err := headerTpl.Execute(buffer, headerDataCopy); err != nil {
-		pageIncomplete = true
-	}
-
-	if err := notFoundTpl.Execute(buffer, nil); err != nil {
-		pageIncomplete = true
-	}
-
-	if err := footerTpl.Execute(buffer, nil); err != nil {
-		pageIncomplete = true
-	}
-
-	w.WriteHeader(http.StatusNotFound)
-	if _, err := fmt.Fprint(w, buffer); err != nil {
-		pageIncomplete = true
-	}
-
-	if pageIncomplete {
-		res := httpResponse{Error: true, Message: "couldn't execute template"}
-		res.JSON(http.StatusInternalServerError, w)
-		return
-	}
+func (s *server) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	setRoute(w, "not_found")
+	s.templateHandler(w, r, http.StatusNotFound, "404", s.pageOf(r))
 }
 
-func handleAsset(w http.ResponseWriter, r *http.Request, path string) bool {
+func (s *server) handleAsset(w http.ResponseWriter, r *http.Request, path string) bool {
 	switch path {
 	case "/favicon.ico":
+		setRoute(w, "asset")
 		ico, err := base64.StdEncoding.DecodeString(images.FaviconICO)
 		if err != nil {
 			return false
@@ -131,111 +428,210 @@ func handleAsset(w http.ResponseWriter, r *http.Request, path string) bool {
 		}
 		return true
 	case "/about":
-		templateHandler(w, r, aboutTpl, nil)
+		setRoute(w, "about")
+		s.templateHandler(w, r, http.StatusOK, "about", s.pageOf(r))
 		return true
-	case "/_toggleTheme":
-		var darkTheme bool
-		themeCookie, err := r.Cookie("dark-theme")
-		if err == nil {
-			darkTheme, _ = strconv.ParseBool(themeCookie.Value)
+	case "/_admin/lockouts":
+		if _, ok := s.tokenAuth(r); !ok {
+			return false
 		}
-
+		s.lockoutsHandler(w, r)
+		return true
+	case "/_admin/webhooks":
+		if _, ok := s.tokenAuth(r); !ok {
+			return false
+		}
+		s.webhooksHandler(w, r)
+		return true
+	case "/_toggleTheme":
+		setRoute(w, "theme")
 		// toggle the theme
-		darkTheme = !darkTheme
+		darkTheme := !s.darkTheme(r)
 
 		cookie := &http.Cookie{
 			Name:    "dark-theme",
 			Value:   strconv.FormatBool(darkTheme),
-			Path:    "/",
+			Path:    s.linksOf(r).Href("."),
 			Expires: time.Now().Add(7 * 24 * time.Hour),
 		}
 
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			referer = s.linksOf(r).Href(".")
+		}
+
 		http.SetCookie(w, cookie)
-		http.Redirect(w, r, r.Header.Get("Referer"), http.StatusFound)
+		http.Redirect(w, r, referer, http.StatusFound)
 		return true
 	default:
-		return false
+		return s.serveStylesheet(w, r, path)
 	}
 }
 
-func pathHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+func (s *server) pathHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	path := filepath.Clean(ps.ByName("path"))
-	if handleAsset(w, r, path) {
+	if s.handleAsset(w, r, path) {
 		return
 	}
 
-	ctx := r.Context()
-	cookie, err := r.Cookie("dark-theme")
-	if err == nil {
-		value, _ := strconv.ParseBool(cookie.Value)
-		ctx = context.WithValue(ctx, cookie.Name, value)
+	if rest, ok := trimPrefix(path, "/_du"); ok {
+		s.duHandler(w, r, rest)
+		return
 	}
-
-	r = r.WithContext(ctx)
-
-	if filepath.IsAbs(path) {
-		path = path[1:]
+	if rest, ok := trimPrefix(path, "/_events"); ok {
+		s.eventsHandler(w, r, rest)
+		return
+	}
+	if rest, ok := trimPrefix(path, "/_jobs"); ok {
+		s.jobsHandler(w, r, rest)
+		return
 	}
 
-	path = filepath.Join(config.Get().Root, path)
+	path = s.fs.Join(path)
 
-	fd, err := fs.Read(path)
+	fd, err := s.fs.Read(path)
+	if err == nil && fd.IsArchive && strings.HasSuffix(r.URL.Path, "/") {
+		// a trailing slash lists the archive's members
+		fd, err = s.fs.ReadArchive(path)
+	}
 	if err != nil {
-		notFoundHandler(w, r)
+		if algorithm, ok := fs.Manifests[filepath.Base(path)]; ok && s.manifestHandler(w, r, filepath.Dir(path), algorithm) {
+			return
+		}
+		s.notFoundHandler(w, r)
 		return
 	}
 
-	if !checkPass(fd, w, r) {
+	if !s.checkPass(fd, w, r) {
 		return
 	}
 
 	q := r.URL.Query()
-	if _, ok := q["json"]; ok {
+	if algorithm := q.Get("checksum"); algorithm != "" {
+		s.checksumHandler(w, r, path, fd, algorithm)
+		return
+	}
+
+	if cc := s.cacheControl(r.URL.Path, fd.Password != ""); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+
+	if kind := q.Get("feed"); kind != "" {
+		s.feedHandler(w, r, path, fd, kind)
+		return
+	}
+
+	_, asJSON := q["json"]
+	if !asJSON && fd.IsDir {
+		if index := s.index(r.URL.Path, fd); index != nil {
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				// the relative links of the page need the trailing slash
+				http.Redirect(w, r, s.linksOf(r).Href(fd.Path)+"/", http.StatusMovedPermanently)
+				return
+			}
+			path, fd = s.fs.Join(index.Path), index
+		}
+	}
+
+	if asJSON || fd.IsDir {
+		if notModified(w, r, s.listingETag(r, fd, asJSON), fd.LastModified()) {
+			setRoute(w, "not_modified")
+			return
+		}
+	}
+
+	if asJSON {
+		setRoute(w, "json")
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		if _, err := fmt.Fprint(w, fd.JSON()); err != nil {
-			logrus.WithError(err).Error("couldn't print to response writer for json query")
+			s.log.WithError(err).Error("couldn't print to response writer for json query")
 		}
 		return
 	}
 
 	if fd.IsDir {
-		templateHandler(w, r, dirListTpl, fd)
+		setRoute(w, "list")
+		s.templateHandler(w, r, http.StatusOK, "list", nodePage{fd, s.pageOf(r)})
+	} else if fd.InArchive() {
+		setRoute(w, "archive_member")
+		s.serveMember(w, r, fd)
 	} else {
-		http.ServeFile(w, r, path)
+		setRoute(w, "file")
+		metrics.ActiveDownloads.Inc()
+		defer metrics.ActiveDownloads.Dec()
+		// ServeFile answers the conditional requests itself
+		w.Header().Set("ETag", fileETag(fd))
+		tw := s.throttle(w, r)
+		if s.servePrecompressed(tw, r, path, fd) {
+			return
+		}
+		s.setDigest(w, r, path)
+		http.ServeFile(tw, r, path)
 	}
 }
 
-func passFormHandler(n *fs.Node, w http.ResponseWriter) {
-	tpls := templates.HTMLHeader + templates.HTMLFooter + templates.HTMLPassForm
-	t, err := template.New("pass").Parse(tpls)
-	if err != nil {
-		res := httpResponse{true, "couldn't parse template", err.Error()}
-		res.JSON(http.StatusInternalServerError, w)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err = t.Execute(w, n); err != nil {
-		res := httpResponse{true, "couldn't execute template", err.Error()}
-		res.JSON(http.StatusInternalServerError, w)
-		return
-	}
+func (s *server) passFormHandler(n *fs.Node, w http.ResponseWriter, r *http.Request) {
+	setRoute(w, "password")
+	s.templateHandler(w, r, http.StatusUnauthorized, "pass", nodePage{n, s.pageOf(r)})
 }
 
-func checkPass(n *fs.Node, w http.ResponseWriter, r *http.Request) bool {
+func (s *server) checkPass(n *fs.Node, w http.ResponseWriter, r *http.Request) bool {
 	if n.Password == "" {
 		return true
 	}
 
+	if _, ok := s.tokenAuth(r); ok {
+		s.audit(r, audit.Entry{Type: audit.Password, Success: true, Detail: "unlocked with API token"})
+		return true
+	}
+
 	if r.Method == "GET" {
-		passFormHandler(n, w)
+		s.passFormHandler(n, w, r)
+		return false
+	}
+
+	// the paths of the sites are told apart by their host
+	ip, path := s.clientIP(r), s.host+pathpkg.Clean("/"+r.URL.Path)
+	if wait := maxDuration(s.opts.IPGuard.Check(ip), s.opts.PathGuard.Check(path)); wait > 0 {
+		s.audit(r, audit.Entry{Type: audit.Password, Success: false, Detail: "locked out"})
+		tooManyAttempts(w, wait)
 		return false
 	}
 
 	if !n.HasPassword(r.FormValue("password")) {
-		passFormHandler(n, w)
+		metrics.PasswordFailures.Inc()
+		s.opts.IPGuard.Fail(ip)
+		s.opts.PathGuard.Fail(path)
+		s.audit(r, audit.Entry{Type: audit.Password, Success: false})
+		s.passFormHandler(n, w, r)
 		return false
 	}
 
+	s.opts.IPGuard.Succeed(ip)
+	s.opts.PathGuard.Succeed(path)
+	s.audit(r, audit.Entry{Type: audit.Password, Success: true})
 	return true
 }
+
+// render executes the page template name with data between the header and footer, into a buffer.
+func (s *server) render(r *http.Request, name string, data interface{}) (*bytes.Buffer, error) {
+	header := headerData
+	header.page = s.pageOf(r)
+	header.DarkTheme = s.darkTheme(r)
+	header.Static = s.static
+	buffer := bytes.NewBufferString("")
+
+	if err := tpls["header"].Execute(buffer, header); err != nil {
+		return nil, err
+	}
+
+	if err := tpls[name].Execute(buffer, data); err != nil {
+		return nil, err
+	}
+
+	if err := tpls["footer"].Execute(buffer, header); err != nil {
+		return nil, err
+	}
+
+	return buffer, nil
+}
@@ -0,0 +1,549 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/json"
+	"filekeep/config"
+	"filekeep/fs"
+	"filekeep/guard"
+	"filekeep/helpers"
+	"filekeep/ratelimit"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempRoot(t *testing.T, files ...string) string {
+	root, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	for _, name := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func get(t *testing.T, h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w
+}
+
+func TestNewHandlerMounted(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/files/", NewHandler(Options{Root: tempRoot(t, "docs/a.txt"), Prefix: "/files/"}))
+	mux.Handle("/builds/", NewHandler(Options{Root: tempRoot(t, "b.txt"), Prefix: "/builds"}))
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+		body   string
+	}{
+		{"file", "/files/docs/a.txt", http.StatusOK, "docs/a.txt"},
+		{"other root", "/builds/b.txt", http.StatusOK, "b.txt"},
+		{"not in root", "/builds/docs/a.txt", http.StatusNotFound, ""},
+		{"links", "/files/docs", http.StatusOK, `href="/files/docs/a.txt"`},
+		{"breadcrumbs", "/files/docs", http.StatusOK, `<a href="/files/">~</a>`},
+		{"footer", "/builds/", http.StatusOK, `href="/builds/about"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := get(t, mux, test.target)
+			if w.Code != test.code {
+				t.Fatalf("expected status %d, got %d", test.code, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), test.body) {
+				t.Errorf("expected body to contain %q, got %q", test.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewHandlerOutsidePrefix(t *testing.T) {
+	h := NewHandler(Options{Root: tempRoot(t, "a.txt"), Prefix: "/files"})
+
+	for _, target := range []string{"/a.txt", "/filesa.txt"} {
+		if w := get(t, h, target); w.Code != http.StatusNotFound {
+			t.Errorf("expected %q to be not found, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestForwardedPrefix(t *testing.T) {
+	trusted, _ := helpers.ParseNets([]string{"192.0.2.1"})
+	h := NewHandler(Options{Root: tempRoot(t, "docs/a.txt"), Prefix: "/filekeep", TrustedProxies: trusted})
+
+	tests := []struct {
+		name   string
+		target string
+		prefix string
+		remote string
+		code   int
+		body   string
+	}{
+		{"base path", "/filekeep/docs", "", "", http.StatusOK, `href="/filekeep/docs/a.txt"`},
+		{"stripped by proxy", "/docs", "/proxied/", "", http.StatusOK, `href="/proxied/docs/a.txt"`},
+		{"kept by proxy", "/filekeep/docs", "/proxied", "", http.StatusOK, `<base href="/proxied/"/>`},
+		{"untrusted", "/filekeep/docs", "/proxied", "203.0.113.9:1234", http.StatusOK, `<base href="/filekeep/"/>`},
+		{"untrusted outside prefix", "/docs", "/proxied", "203.0.113.9:1234", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", test.target, nil)
+			if test.prefix != "" {
+				r.Header.Set("X-Forwarded-Prefix", test.prefix)
+			}
+			if test.remote != "" {
+				r.RemoteAddr = test.remote
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Fatalf("expected status %d, got %d", test.code, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), test.body) {
+				t.Errorf("expected body to contain %q", test.body)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/_toggleTheme", nil)
+	r.Header.Set("X-Forwarded-Prefix", "/proxied")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if cookie := w.Result().Cookies(); len(cookie) != 1 || cookie[0].Path != "/proxied/" {
+		t.Errorf("expected theme cookie scoped to /proxied/, got %v", cookie)
+	}
+	if location := w.Header().Get("Location"); location != "/proxied/" {
+		t.Errorf("expected redirect to /proxied/, got %q", location)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	root := tempRoot(t, "a.txt", "metrics")
+
+	h := NewHandler(Options{Root: root, Metrics: true})
+	get(t, h, "/a.txt")
+	w := get(t, h, "/metrics")
+	if !strings.Contains(w.Body.String(), `filekeep_http_requests_total{code="200",route="file"}`) {
+		t.Errorf("expected file requests to be counted, got:\n%s", w.Body.String())
+	}
+
+	h = NewHandler(Options{Root: root})
+	if w := get(t, h, "/metrics"); w.Body.String() != "metrics" {
+		t.Errorf("expected the metrics file to be served when metrics are disabled, got %q", w.Body.String())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	trusted, _ := helpers.ParseNets([]string{"192.0.2.1"})
+
+	var buf bytes.Buffer
+	h := NewHandler(Options{
+		Root:            tempRoot(t, "a.txt"),
+		Tokens:          map[string]string{"ci": "s3cret"},
+		AccessLog:       &buf,
+		AccessLogFormat: "json",
+		TrustedProxies:  trusted,
+	})
+
+	r := httptest.NewRequest("GET", "/a.txt?x=1", nil)
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	r.Header.Set("Authorization", "Bearer s3cret")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var e accessEntry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ClientIP != "198.51.100.7" || e.User != "ci" || e.URI != "/a.txt?x=1" || e.Status != 200 || e.Bytes != 5 || e.Route != "file" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	buf.Reset()
+	h = NewHandler(Options{Root: tempRoot(t), AccessLog: &buf})
+	r = httptest.NewRequest("GET", "/missing", nil)
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !strings.HasPrefix(buf.String(), `192.0.2.1 - - [`) || !strings.Contains(buf.String(), `"GET /missing HTTP/1.1" 404 `) {
+		t.Errorf("unexpected combined log line %q", buf.String())
+	}
+}
+
+func TestPasswordLockout(t *testing.T) {
+	root := tempRoot(t, "a.txt")
+	sum := md5.Sum([]byte("right"))
+	if err := ioutil.WriteFile(filepath.Join(root, ".a.txt"), []byte(fmt.Sprintf("%x\n", sum)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ipGuard := guard.New(guard.Policy{Attempts: 2, Lockout: time.Minute})
+	h := NewHandler(Options{Root: root, IPGuard: ipGuard, Tokens: map[string]string{"ci": "s3cret"}})
+	try := func(password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/a.txt", strings.NewReader(url.Values{"password": {password}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := try("wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected attempt %d to be unauthorized, got %d", i+1, w.Code)
+		}
+	}
+
+	w := try("right")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the client to be locked out, got %d", w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "60" {
+		t.Errorf("expected Retry-After 60, got %q", retry)
+	}
+
+	r := httptest.NewRequest("GET", "/_admin/lockouts?json", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var res struct {
+		Raw map[string][]guard.Status `json:"raw"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if c := res.Raw["client"]; len(c) != 1 || c[0].Key != "192.0.2.1" || c[0].Failures != 2 {
+		t.Errorf("expected the lockout to be listed, got %+v", res.Raw)
+	}
+	if w := get(t, h, "/_admin/lockouts"); w.Code != http.StatusNotFound {
+		t.Errorf("expected the lockouts page to require a token, got %d", w.Code)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	bw := new(ratelimit.Bandwidth)
+	bw.SetPath("/slow", 1000)
+	h := NewHandler(Options{
+		Root:      tempRoot(t, "a.txt", "slow/big.bin"),
+		Tokens:    map[string]string{"ci": "s3cret"},
+		RateLimit: ratelimit.NewKeyed(1, 2),
+		Bandwidth: bw,
+	})
+
+	for i := 0; i < 2; i++ {
+		if w := get(t, h, "/a.txt"); w.Code != http.StatusOK {
+			t.Fatalf("expected request %d to be allowed, got %d", i+1, w.Code)
+		}
+	}
+	w := get(t, h, "/a.txt")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected the client to be limited, got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	r := httptest.NewRequest("GET", "/a.txt", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected requests with a token to bypass the limit, got %d", w.Code)
+	}
+
+	big := filepath.Join(h.(*server).opts.Root, "slow", "big.bin")
+	if err := ioutil.WriteFile(big, bytes.Repeat([]byte("x"), 1100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("GET", "/slow/big.bin", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	start := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("expected downloads with a token not to be throttled, took %s", d)
+	}
+
+	h.(*server).opts.RateLimit = nil
+	start = time.Now()
+	if w := get(t, h, "/slow/big.bin"); w.Body.Len() != 1100 {
+		t.Fatalf("expected the whole file, got %d bytes", w.Body.Len())
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("expected the download over the burst to be throttled, took %s", d)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	root := tempRoot(t, "docs/a.txt")
+	h := NewHandler(Options{Root: root, CacheControl: map[string]string{"/": "no-cache", "/docs": "public, max-age=60"}})
+
+	do := func(target string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, target := range []string{"/docs", "/docs?json", "/docs/a.txt"} {
+		w := do(target)
+		etag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: expected 200 with an ETag, got %d %q", target, w.Code, etag)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=60" {
+			t.Errorf("%s: expected the Cache-Control of /docs, got %q", target, cc)
+		}
+		if w := do(target, "If-None-Match", etag); w.Code != http.StatusNotModified {
+			t.Errorf("%s: expected 304 for a matching ETag, got %d", target, w.Code)
+		}
+		if w := do(target, "If-Modified-Since", w.Header().Get("Last-Modified")); w.Code != http.StatusNotModified {
+			t.Errorf("%s: expected 304 for an unchanged modification time, got %d", target, w.Code)
+		}
+	}
+
+	etag := do("/docs").Header().Get("ETag")
+	if do("/docs?json").Header().Get("ETag") == etag {
+		t.Error("expected the JSON and HTML listings to have different ETags")
+	}
+	if do("/", "Cookie", "dark-theme=true").Header().Get("ETag") == do("/").Header().Get("ETag") {
+		t.Error("expected the theme to change the ETag of the listing")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "docs", "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if w := do("/docs", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("expected the listing to change with its children, got %d", w.Code)
+	}
+
+	w := do("/")
+	if cc := w.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("expected the default Cache-Control, got %q", cc)
+	}
+	if !strings.Contains(w.Body.String(), `<link rel="stylesheet" href="/_assets/custom.css?v=`) || strings.Contains(w.Body.String(), "<style>") {
+		t.Error("expected the stylesheets to be linked instead of inlined")
+	}
+
+	w = do("/_assets/custom.css?v=" + stylesheets[2].Version)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Cache-Control"), "immutable") || w.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Errorf("expected the versioned stylesheet to be cached forever, got %d %v", w.Code, w.Header())
+	}
+	if w := do("/_assets/custom.css", "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for the stylesheet, got %d", w.Code)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	root := tempRoot(t, "small.txt", "bin/data.bin", "pre/app.js")
+	text := strings.Repeat("a log line\n", 200)
+	files := map[string]string{"big.txt": text, "bin/data.bin": "\x00\x01" + text, "pre/app.js": text, "pre/app.js.gz": "precompressed"}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewHandler(Options{Root: root, Compression: &Compression{MinSize: 1024, Types: []string{"text/*", "application/javascript"}, Precompressed: true}})
+
+	do := func(target string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		accept   string
+		encoding string
+	}{
+		{"gzip", "/big.txt", "gzip, deflate", "gzip"},
+		{"preferred", "/big.txt", "gzip, br", "br"},
+		{"quality", "/big.txt", "br;q=0.5, zstd", "zstd"},
+		{"not accepted", "/big.txt", "br;q=0, identity", ""},
+		{"below threshold", "/small.txt", "gzip", ""},
+		{"not allowed", "/bin/data.bin", "gzip", ""},
+		{"listing", "/", "gzip", "gzip"},
+		{"json", "/?json", "gzip", ""},
+		{"precompressed", "/pre/app.js", "gzip", "gzip"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := do(test.target, "Accept-Encoding", test.accept)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", w.Code)
+			}
+			if enc := w.Header().Get("Content-Encoding"); enc != test.encoding {
+				t.Errorf("expected encoding %q, got %q", test.encoding, enc)
+			}
+			if w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected to vary by Accept-Encoding, got %q", w.Header().Get("Vary"))
+			}
+		})
+	}
+
+	w := do("/big.txt", "Accept-Encoding", "gzip")
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); string(b) != text {
+		t.Error("expected the gzip body to decompress to the file")
+	}
+	if !strings.HasPrefix(w.Header().Get("ETag"), "W/") || w.Header().Get("Content-Length") != "" {
+		t.Errorf("unexpected headers of a compressed response: %v", w.Header())
+	}
+
+	if w := do("/pre/app.js", "Accept-Encoding", "gzip"); w.Body.String() != "precompressed" || w.Header().Get("Content-Type") != "text/javascript; charset=utf-8" {
+		t.Errorf("expected the precompressed sibling as javascript, got %q, %q", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+
+	w = do("/big.txt", "Accept-Encoding", "gzip", "Range", "bytes=0-9")
+	if w.Code != http.StatusPartialContent || w.Header().Get("Content-Encoding") != "" || w.Body.String() != "a log line" {
+		t.Errorf("expected an uncompressed range, got %d %q %q", w.Code, w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+	w = do("/pre/app.js", "Accept-Encoding", "gzip", "Range", "bytes=0-9")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "a log line" {
+		t.Errorf("expected a range of the file itself, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestPrecompressedSiblings(t *testing.T) {
+	root := tempRoot(t, "hidden.js", "hidden.js.br", "protected.js", "protected.js.gz")
+	if err := fs.SetPassword(filepath.Join(root, "protected.js.gz"), "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(Options{
+		Root:        root,
+		HideRules:   config.HideRules{HiddenExts: []string{".br"}},
+		Compression: &Compression{MinSize: 1 << 20, Precompressed: true},
+	})
+
+	for _, test := range []struct{ target, accept string }{{"/hidden.js", "br"}, {"/protected.js", "gzip"}} {
+		r := httptest.NewRequest("GET", test.target, nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), ".js.") {
+			t.Errorf("expected %s without its sibling, got %d %q", test.target, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDeleteRecursive(t *testing.T) {
+	root := tempRoot(t, "plain/a.txt", "plain/sub/b.txt", "hidden/a.txt", "hidden/b.log", "protected/sub/a.txt")
+	if err := fs.SetPassword(filepath.Join(root, "protected/sub/a.txt"), "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(Options{Root: root, HideRules: config.HideRules{HiddenExts: []string{".log"}, Dotfiles: true}, Tokens: map[string]string{"ci": "s3cret"}})
+
+	for target, code := range map[string]int{"/plain": http.StatusOK, "/hidden": http.StatusConflict, "/protected": http.StatusConflict} {
+		r := httptest.NewRequest("DELETE", target+"?recursive", nil)
+		r.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("expected %d deleting %s, got %d: %s", code, target, w.Code, w.Body)
+		}
+		if _, err := os.Stat(filepath.Join(root, target)); (err == nil) != (code != http.StatusOK) {
+			t.Errorf("unexpected %s after deleting it: %v", target, err)
+		}
+	}
+}
+
+func TestProtectedMoveAndDelete(t *testing.T) {
+	root := tempRoot(t, "secret.txt")
+	if err := fs.SetPassword(filepath.Join(root, "secret.txt"), "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(Options{Root: root, Tokens: map[string]string{"ci": "s3cret"}, UploadMaxSize: 8})
+	do := func(method, target, body string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer s3cret")
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("MOVE", "/secret.txt", "", "Destination", "/moved.txt"); w.Code != http.StatusOK {
+		t.Fatalf("expected the move to succeed, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(t, h, "/moved.txt"); w.Body.String() == "secret.txt" {
+		t.Error("expected the moved file to keep its password")
+	}
+	if w := do("PUT", "/secret.txt", "public"); w.Code != http.StatusCreated {
+		t.Fatalf("expected the upload to succeed, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(t, h, "/secret.txt"); w.Body.String() != "public" {
+		t.Errorf("expected a new file at the old path not to inherit the password, got %q", w.Body)
+	}
+
+	if w := do("DELETE", "/moved.txt", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected the deletion to succeed, got %d: %s", w.Code, w.Body)
+	}
+	do("PUT", "/moved.txt", "public")
+	if w := get(t, h, "/moved.txt"); w.Body.String() != "public" {
+		t.Errorf("expected a new file at a deleted path not to inherit the password, got %q", w.Body)
+	}
+
+	if w := do("PUT", "/big.txt", "more than eight bytes"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected an upload over UploadMaxSize to be refused, got %d", w.Code)
+	}
+	r := httptest.NewRequest("PUT", "/big.txt", struct{ io.Reader }{strings.NewReader("more than eight bytes")})
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if _, err := os.Stat(filepath.Join(root, "big.txt")); w.Code != http.StatusRequestEntityTooLarge || err == nil {
+		t.Errorf("expected an upload of unknown length over UploadMaxSize to be refused, got %d", w.Code)
+	}
+}
+
+func TestMounts(t *testing.T) {
+	h := NewHandler(Options{
+		Root:   tempRoot(t, "a.txt"),
+		Mounts: []config.Mount{{Name: "disk", Path: tempRoot(t, "sub/b.txt"), ReadOnly: true}},
+		Tokens: map[string]string{"ci": "s3cret"},
+	})
+
+	w := get(t, h, "/disk/sub/")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/disk/sub/b.txt"`) {
+		t.Errorf("expected the listing of the mount, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(t, h, "/disk/sub/b.txt"); w.Body.String() != "sub/b.txt" {
+		t.Errorf("expected the file of the mount, got %q", w.Body)
+	}
+
+	r := httptest.NewRequest("PUT", "/disk/c.txt", strings.NewReader("c"))
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected the upload into a read-only mount to be forbidden, got %d", w.Code)
+	}
+}
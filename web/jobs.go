@@ -0,0 +1,168 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"filekeep/audit"
+	"filekeep/config"
+	"filekeep/fs"
+	"filekeep/jobs"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+)
+
+// Jobs returns the job manager described by the config c, or nil if the jobs are disabled.
+func Jobs(c *config.Config) *jobs.Manager {
+	if !c.Jobs.Enabled {
+		return nil
+	}
+	return jobs.New(c.Jobs.Workers, c.Jobs.Keep)
+}
+
+// jobRequest is the body of the requests starting a job. Paths are URL paths.
+type jobRequest struct {
+	// Archive is the archive to extract.
+	Archive string `json:"archive"`
+	// Paths are the files and directories to compress.
+	Paths []string `json:"paths"`
+	// Dest is the directory to extract into, or the archive to create.
+	Dest string `json:"dest"`
+}
+
+// jobsHandler serves the jobs API under /_jobs, for API token holders:
+// GET / lists the jobs, POST /extract and POST /compress start one, GET /<id> shows one,
+// and POST /<id>/cancel cancels it.
+func (s *server) jobsHandler(w http.ResponseWriter, r *http.Request, path string) {
+	setRoute(w, "jobs")
+	if s.opts.Jobs == nil {
+		s.notFoundHandler(w, r)
+		return
+	}
+	if _, ok := s.tokenAuth(r); !ok {
+		res := httpResponse{Error: true, Message: "a valid API token is required"}
+		res.JSON(http.StatusForbidden, w)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case path == "/" && r.Method == "GET":
+		res := httpResponse{Raw: s.opts.Jobs.List()}
+		res.JSON(http.StatusOK, w)
+	case (path == "/extract" || path == "/compress") && r.Method == "POST":
+		s.startJob(w, r, parts[0])
+	case len(parts) == 1 && r.Method == "GET":
+		j, err := s.opts.Jobs.Get(parts[0])
+		if err != nil {
+			s.notFoundHandler(w, r)
+			return
+		}
+		res := httpResponse{Raw: j.Status()}
+		res.JSON(http.StatusOK, w)
+	case len(parts) == 2 && parts[1] == "cancel" && r.Method == "POST":
+		j, err := s.opts.Jobs.Cancel(parts[0])
+		if err != nil {
+			s.notFoundHandler(w, r)
+			return
+		}
+		res := httpResponse{Raw: j.Status()}
+		res.JSON(http.StatusOK, w)
+	default:
+		res := httpResponse{Error: true, Message: "unknown jobs request"}
+		res.JSON(http.StatusNotFound, w)
+	}
+}
+
+// startJob validates the request to extract or compress, and starts its job.
+func (s *server) startJob(w http.ResponseWriter, r *http.Request, typ string) {
+	var req jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		res := httpResponse{Error: true, Message: "couldn't decode request: " + err.Error()}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+
+	if typ == "extract" {
+		req.Paths = []string{req.Archive}
+		if req.Dest == "" {
+			// next to the archive, named after it
+			req.Dest = strings.TrimSuffix(req.Archive, filepath.Ext(req.Archive))
+			req.Dest = strings.TrimSuffix(req.Dest, ".tar")
+		}
+	}
+	if len(req.Paths) == 0 || req.Dest == "" {
+		res := httpResponse{Error: true, Message: "missing paths or destination"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+
+	paths := make([]string, len(req.Paths))
+	for i, p := range req.Paths {
+		paths[i] = s.fs.Join(p)
+		n, err := s.fs.Read(paths[i])
+		if err != nil || n.InArchive() || (typ == "extract" && (n.IsDir || fs.ArchiveKind(n.Name) == "")) {
+			res := httpResponse{Error: true, Message: "path not found: " + p}
+			res.JSON(http.StatusNotFound, w)
+			return
+		}
+		if n.Password != "" {
+			res := httpResponse{Error: true, Message: "password protected path: " + p}
+			res.JSON(http.StatusForbidden, w)
+			return
+		}
+	}
+
+	dest := s.fs.Join(req.Dest)
+	if s.fs.IsRoot(dest) || s.fs.IsHidden(dest) {
+		res := httpResponse{Error: true, Message: "invalid destination"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+	if s.readOnly(w, dest) {
+		return
+	}
+	if typ == "compress" && fs.ArchiveKind(dest) == "" {
+		res := httpResponse{Error: true, Message: "the destination must end with .zip, .tar, .tar.gz or .tgz"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+	if dir, err := s.fs.Read(filepath.Dir(dest)); err != nil || !dir.IsDir || dir.InArchive() {
+		res := httpResponse{Error: true, Message: "parent directory not found"}
+		res.JSON(http.StatusNotFound, w)
+		return
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		res := httpResponse{Error: true, Message: "destination already exists"}
+		res.JSON(http.StatusConflict, w)
+		return
+	}
+
+	limits := s.opts.JobLimits
+	result := pathpkg.Clean("/" + req.Dest)
+	j := s.opts.Jobs.Start(typ, func(ctx context.Context, j *jobs.Job) (string, error) {
+		var err error
+		if typ == "extract" {
+			err = s.fs.Extract(ctx, paths[0], dest, limits, j)
+		} else {
+			err = s.fs.Compress(ctx, paths, dest, limits, j)
+		}
+		if err != nil {
+			s.log.WithError(err).Errorf("couldn't %s %q", typ, dest)
+			return "", err
+		}
+		return result, nil
+	})
+
+	entryType := audit.Extract
+	if typ == "compress" {
+		entryType = audit.Compress
+	}
+	s.audit(r, audit.Entry{Type: entryType, Path: result, Success: true, Detail: "job " + j.Status().ID})
+
+	w.Header().Set("Location", s.linksOf(r).Href("/_jobs/"+j.Status().ID))
+	res := httpResponse{Raw: j.Status()}
+	res.JSON(http.StatusAccepted, w)
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"filekeep/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// responseWriter records the status code, body size and route of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+	route string
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// setRoute names the route handling the response, used as a metrics label.
+func setRoute(w http.ResponseWriter, route string) {
+	for {
+		switch v := w.(type) {
+		case *responseWriter:
+			v.route = route
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// instrument serves the request with next, and records its metrics and access log entry.
+func (s *server) instrument(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter, *http.Request)) {
+	rw := &responseWriter{ResponseWriter: w, route: "other"}
+	start := time.Now()
+
+	next(rw, r)
+
+	code := strconv.Itoa(rw.status())
+	metrics.Requests.WithLabelValues(rw.route, code).Inc()
+	metrics.RequestDuration.WithLabelValues(rw.route, code).Observe(time.Since(start).Seconds())
+	metrics.BytesServed.WithLabelValues(rw.route).Add(float64(rw.bytes))
+
+	s.logAccess(rw, r, start)
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"filekeep/config"
+	"filekeep/ratelimit"
+	"net/http"
+	"time"
+)
+
+// writeTimeout is the time allowed to write a response, extended while a throttled response waits.
+const writeTimeout = 30 * time.Second
+
+// RateLimit returns the per client request limit described by the config, nil if disabled.
+func RateLimit(c *config.Config) *ratelimit.Keyed {
+	return ratelimit.NewKeyed(c.RateLimit.Requests, c.RateLimit.Burst)
+}
+
+// Bandwidth returns the bandwidth caps described by the config, nil if none is set.
+func Bandwidth(c *config.Config) *ratelimit.Bandwidth {
+	bw := &ratelimit.Bandwidth{
+		Global: ratelimit.NewBucket(float64(c.Bandwidth.Global), 0),
+		PerIP:  ratelimit.NewKeyed(float64(c.Bandwidth.PerIP), 0),
+	}
+	for prefix, rate := range c.Bandwidth.Paths {
+		bw.SetPath(prefix, float64(rate))
+	}
+	if bw.Global == nil && bw.PerIP == nil && len(c.Bandwidth.Paths) == 0 {
+		return nil
+	}
+	return bw
+}
+
+// allowRequest takes a token of the client's request limit, or responds with 429 Too Many Requests.
+// Requests with an API token are never limited.
+func (s *server) allowRequest(w http.ResponseWriter, r *http.Request) bool {
+	if s.opts.RateLimit == nil {
+		return true
+	}
+	if _, ok := s.tokenAuth(r); ok {
+		return true
+	}
+
+	ok, wait := s.opts.RateLimit.Get(s.clientIP(r)).Allow()
+	if !ok {
+		tooManyRequests(w, "rate_limited", "too many requests", wait)
+	}
+	return ok
+}
+
+// throttledWriter is a http.ResponseWriter whose body writes are throttled.
+type throttledWriter struct {
+	http.ResponseWriter
+	w *ratelimit.Writer
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	return t.w.Write(p)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (t *throttledWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// throttle returns w throttled by the bandwidth caps of the client and the request path,
+// or w itself if none apply. Requests with an API token are never throttled.
+func (s *server) throttle(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	buckets := s.opts.Bandwidth.Buckets(s.clientIP(r), r.URL.Path)
+	if len(buckets) == 0 {
+		return w
+	}
+	if _, ok := s.tokenAuth(r); ok {
+		return w
+	}
+
+	rc := http.NewResponseController(w)
+	return &throttledWriter{
+		ResponseWriter: w,
+		w: &ratelimit.Writer{
+			W:       w,
+			Ctx:     r.Context(),
+			Buckets: buckets,
+			BeforeWait: func(wait time.Duration) {
+				// a throttled download may well take longer than the server's write timeout
+				rc.SetWriteDeadline(time.Now().Add(wait + writeTimeout))
+			},
+		},
+	}
+}
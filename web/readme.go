@@ -0,0 +1,73 @@
+package web
+
+import (
+	"filekeep/config"
+	"filekeep/fs"
+	"filekeep/helpers"
+	"filekeep/markdown"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// readmeNames returns the names of the header or footer files, nil if they're disabled.
+func readmeNames(c *config.Config, names []string) []string {
+	if !c.Readme.Enabled {
+		return nil
+	}
+	return names
+}
+
+// readme renders the first file of the directory n named like one of names, Markdown as HTML and
+// anything else as plain text. Hidden, protected and too big files are left out.
+func (s *server) readme(links helpers.Links, n *fs.Node, names []string) template.HTML {
+	if n == nil || n.InArchive() {
+		return ""
+	}
+	f := findFile(n, names)
+	if f == nil || (s.opts.ReadmeMaxSize > 0 && int64(f.Size) > s.opts.ReadmeMaxSize) {
+		return ""
+	}
+
+	b, err := ioutil.ReadFile(s.fs.Join(f.Path))
+	if err != nil {
+		s.log.WithError(err).Errorf("couldn't read %q", f.Path)
+		return ""
+	}
+	switch strings.ToLower(filepath.Ext(f.Name)) {
+	case ".md", ".markdown":
+		return markdown.Render(b, strings.TrimSuffix(links.Href(n.Path), "/")+"/")
+	default:
+		return template.HTML("<pre>" + html.EscapeString(string(b)) + "</pre>")
+	}
+}
+
+// index returns the index.html of the directory n at the URL path, if it's served instead of the listing.
+func (s *server) index(path string, n *fs.Node) *fs.Node {
+	var match string
+	var enabled bool
+	for prefix, v := range s.opts.Index {
+		if prefix, ok := underPrefix(path, prefix); ok && len(prefix) >= len(match) {
+			match, enabled = prefix, v
+		}
+	}
+	if !enabled || n.InArchive() {
+		return nil
+	}
+	return findFile(n, []string{"index.html", "index.htm"})
+}
+
+// findFile returns the first visible, unprotected file of the directory n named like one of names,
+// ignoring the case.
+func findFile(n *fs.Node, names []string) *fs.Node {
+	for _, name := range names {
+		for _, f := range n.Files {
+			if strings.EqualFold(f.Name, name) && f.Password == "" {
+				return f
+			}
+		}
+	}
+	return nil
+}
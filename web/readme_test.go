@@ -0,0 +1,54 @@
+package web
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadme(t *testing.T) {
+	root := tempRoot(t, "docs/a.txt", "site/index.html", "site/b.txt", "plain/README.txt")
+	files := map[string]string{
+		"docs/HEADER.md":   "# Docs\n\nSee [a](a.txt) <script>alert(1)</script>",
+		"docs/README.md":   "*the end*",
+		"plain/README.txt": "<b>as is</b>",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewHandler(Options{
+		Root:    root,
+		Headers: []string{"HEADER.md"},
+		Footers: []string{"README.md", "README.txt"},
+		Index:   map[string]bool{"/": false, "/site": true},
+	})
+
+	body := get(t, h, "/docs").Body.String()
+	for _, s := range []string{"<h1>Docs</h1>", `<a href="/docs/a.txt">a</a>`, "<em>the end</em>"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected the listing to contain %q", s)
+		}
+	}
+	if strings.Contains(body, "<script>alert") {
+		t.Error("expected the raw HTML of the header to be left out")
+	}
+	if strings.Index(body, "<h1>Docs</h1>") > strings.Index(body, "listing") || strings.Index(body, "<em>the end</em>") < strings.Index(body, "listing") {
+		t.Error("expected the header above the listing and the footer below it")
+	}
+	if body := get(t, h, "/plain").Body.String(); !strings.Contains(body, "<pre>&lt;b&gt;as is&lt;/b&gt;</pre>") {
+		t.Errorf("expected the text footer to be escaped, got %q", body)
+	}
+
+	if w := get(t, h, "/site"); w.Code != 301 || w.Header().Get("Location") != "/site/" {
+		t.Errorf("expected a redirect to /site/, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get(t, h, "/site/"); w.Body.String() != "site/index.html" {
+		t.Errorf("expected the index to be served, got %q", w.Body.String())
+	}
+	if w := get(t, h, "/site/?json"); !strings.Contains(w.Body.String(), "b.txt") {
+		t.Errorf("expected the JSON listing, got %q", w.Body.String())
+	}
+}
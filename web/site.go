@@ -0,0 +1,88 @@
+package web
+
+import (
+	"filekeep/config"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Site is a site served by the handler for the requests to its host name, with its own files and settings.
+// The other options are the ones of the handler.
+type Site struct {
+	// Root is the directory being served. Defaults to ".", the runtime dir.
+	Root string
+	// HideRules decide which files and directories are hidden.
+	HideRules config.HideRules
+	// Mounts are the other directories served as top-level directories of the root.
+	Mounts []config.Mount
+	// Theme is the theme of the listings until toggled. Defaults to the theme of the handler.
+	Theme string
+	// Tokens maps API token names to their secret values. Nil disables the uploads, deletions, moves and jobs.
+	Tokens map[string]string
+}
+
+// Sites returns the sites described by the config c, by host name.
+func Sites(c *config.Config) map[string]Site {
+	if len(c.Sites) == 0 {
+		return nil
+	}
+	sites := make(map[string]Site, len(c.Sites))
+	for host, site := range c.Sites {
+		sites[host] = Site{
+			Root:      site.Root,
+			HideRules: c.SiteRules(site),
+			Mounts:    site.Mounts,
+			Theme:     site.Theme,
+			Tokens:    site.Tokens,
+		}
+	}
+	return sites
+}
+
+// Site returns the options serving the site, the same as opts otherwise.
+func (opts Options) Site(site Site) Options {
+	opts.Root, opts.HideRules, opts.Mounts, opts.Tokens = site.Root, site.HideRules, site.Mounts, site.Tokens
+	if site.Theme != "" {
+		opts.Theme = site.Theme
+	}
+	opts.Sites = nil
+	return opts
+}
+
+// ForHost returns the options serving the requests to host, the ones of its site if any, else opts.
+func (opts Options) ForHost(host string) (Options, bool) {
+	for name, site := range opts.Sites {
+		if hostName(name) == hostName(host) {
+			return opts.Site(site), true
+		}
+	}
+	return opts, false
+}
+
+// siteOf returns the server of the site of the request's Host header, s itself for the other hosts.
+func (s *server) siteOf(r *http.Request) *server {
+	if site, ok := s.sites[hostName(r.Host)]; ok {
+		return site
+	}
+	return s
+}
+
+// hostName returns the host lowercased, without its port and the trailing dot of a fully qualified name.
+func hostName(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// darkTheme returns whether the request is shown the dark theme, as toggled by its cookie, or by default.
+func (s *server) darkTheme(r *http.Request) bool {
+	if cookie, err := r.Cookie("dark-theme"); err == nil {
+		if dark, err := strconv.ParseBool(cookie.Value); err == nil {
+			return dark
+		}
+	}
+	return s.opts.Theme == "dark"
+}
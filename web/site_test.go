@@ -0,0 +1,77 @@
+package web
+
+import (
+	"filekeep/config"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSites(t *testing.T) {
+	h := NewHandler(Options{
+		Root:   tempRoot(t, "root.txt"),
+		Tokens: map[string]string{"admin": "s3cret"},
+		Sites: map[string]Site{
+			"Docs.Example":   {Root: tempRoot(t, "docs.txt"), Theme: "dark"},
+			"builds.example": {Root: tempRoot(t, "builds.txt"), Tokens: map[string]string{"ci": "ci-s3cret"}},
+		},
+	})
+	serve := func(method, host, target, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader("x"))
+		r.Host = host
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for host, want := range map[string]string{"docs.example:8080": "docs.txt", "builds.example": "builds.txt", "other.example": "root.txt"} {
+		if w := serve("GET", host, "/", ""); !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected the listing of %s to show %s, got %s", host, want, w.Body)
+		}
+	}
+	if w := serve("GET", "docs.example", "/", ""); !strings.Contains(w.Body.String(), "dark-grey") {
+		t.Error("expected the theme of the site")
+	}
+	if w := serve("GET", "other.example", "/", ""); strings.Contains(w.Body.String(), "dark-grey") {
+		t.Error("expected the default theme for the other hosts")
+	}
+
+	if w := serve("PUT", "builds.example", "/a.txt", "s3cret"); w.Code != http.StatusForbidden {
+		t.Errorf("expected the tokens of the config to be refused by the site, got %d", w.Code)
+	}
+	if w := serve("PUT", "builds.example", "/a.txt", "ci-s3cret"); w.Code != http.StatusCreated {
+		t.Errorf("expected the token of the site to upload, got %d", w.Code)
+	}
+	if w := serve("GET", "other.example", "/a.txt", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the upload to be in the site only, got %d", w.Code)
+	}
+}
+
+func TestSitesHideRules(t *testing.T) {
+	root := tempRoot(t)
+	c, err := config.Parse([]byte(fmt.Sprintf(`root: %[1]s
+hidden_extensions: [.log]
+sites:
+  inherit.example:
+    root: %[1]s
+  own.example:
+    root: %[1]s
+    hidden_extensions: []
+`, root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sites := Sites(c)
+	if exts := sites["inherit.example"].HideRules.HiddenExts; len(exts) != 1 || exts[0] != ".log" {
+		t.Errorf("expected a site without hide rules to use the ones of the config, got %v", exts)
+	}
+	if exts := sites["own.example"].HideRules.HiddenExts; len(exts) != 0 {
+		t.Errorf("expected a site to keep its own hide rules, got %v", exts)
+	}
+}
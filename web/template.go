@@ -1,8 +1,9 @@
 package web
 
 import (
-	"bytes"
 	"filekeep/assets/templates"
+	"filekeep/fs"
+	"filekeep/helpers"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -14,35 +15,98 @@ var (
 
 	notFoundTpl = template.Must(template.New("404").Parse(templates.HTML404))
 
-	aboutTpl   = template.Must(template.New("about").Parse(templates.HTMLAbout))
-	dirListTpl = template.Must(template.New("list").Funcs(funcMap).Parse(templates.HTMLDirList))
+	aboutTpl    = template.Must(template.New("about").Parse(templates.HTMLAbout))
+	dirListTpl  = template.Must(template.New("list").Parse(templates.HTMLDirList))
+	passFormTpl = template.Must(template.New("pass").Parse(templates.HTMLPassForm))
+	lockoutsTpl = template.Must(template.New("lockouts").Parse(templates.HTMLLockouts))
+	duTpl       = template.Must(template.New("du").Parse(templates.HTMLDiskUsage))
 )
 
-func templateHandler(w http.ResponseWriter, r *http.Request, t *template.Template, data interface{}) {
-	pageIncomplete := false
-	headerDataCopy := &headerData
-	headerDataCopy.DarkTheme = r.Context().Value("dark-theme").(bool)
-	buffer := bytes.NewBufferString("")
+// tpls holds the templates by name.
+var tpls = map[string]*template.Template{
+	"header":   headerTpl,
+	"footer":   footerTpl,
+	"404":      notFoundTpl,
+	"about":    aboutTpl,
+	"list":     dirListTpl,
+	"pass":     passFormTpl,
+	"lockouts": lockoutsTpl,
+	"du":       duTpl,
+}
+
+// page is embedded in the data of every template, building its links with the prefix of the request,
+// like {{$.Href .Path}}, and the parts depending on the options of the server.
+type page struct {
+	s     *server
+	links helpers.Links
+}
+
+// pageOf returns the page of the templates rendered for the request.
+func (s *server) pageOf(r *http.Request) page {
+	return page{s: s, links: s.linksOf(r)}
+}
 
-	if err := headerTpl.Execute(buffer, headerDataCopy); err != nil {
-		pageIncomplete = true
+// nodePage is the data of the listing and password pages of a node.
+type nodePage struct {
+	*fs.Node
+	page
+}
+
+// Href returns the URL of the relative path.
+func (p page) Href(path string) string {
+	return p.links.Href(path)
+}
+
+// Breadcrumbs returns the links to the directories of the relative path.
+func (p page) Breadcrumbs(path, separator string) []helpers.Breadcrumb {
+	return p.links.Breadcrumbs(path, separator)
+}
+
+// Events returns the URL of the live updates of the directory at path, empty if they're disabled.
+func (p page) Events(path string) string {
+	if p.s.opts.Events == nil {
+		return ""
 	}
+	return p.links.Under("_events").Href(path)
+}
 
-	if err := t.Execute(buffer, data); err != nil {
-		pageIncomplete = true
+// Du returns the URL of the disk usage explorer of the directory at path, empty without the directory
+// sizes and in static exports.
+func (p page) Du(path string) string {
+	if p.s.fs.Sizes == nil || p.s.static {
+		return ""
 	}
+	return p.links.Under("_du").Href(path)
+}
 
-	if err := footerTpl.Execute(buffer, nil); err != nil {
-		pageIncomplete = true
+// Feed returns the URL of the Atom feed of the directory at path, empty if feeds are disabled.
+func (p page) Feed(path string) string {
+	if !p.s.opts.Feeds || p.s.static {
+		return ""
 	}
+	return p.links.Href(path) + "?feed=atom"
+}
 
-	if _, err := fmt.Fprint(w, buffer); err != nil {
-		pageIncomplete = true
+// Readme renders the header or footer file of the directory n.
+func (p page) Readme(n *fs.Node, position string) template.HTML {
+	if position == "header" {
+		return p.s.readme(p.links, n, p.s.opts.Headers)
 	}
+	return p.s.readme(p.links, n, p.s.opts.Footers)
+}
 
-	if pageIncomplete {
+func (s *server) templateHandler(w http.ResponseWriter, r *http.Request, code int, name string, data interface{}) {
+	buffer, err := s.render(r, name, data)
+	if err != nil {
+		s.log.WithError(err).Errorf("couldn't execute template %q", name)
 		res := httpResponse{Error: true, Message: "couldn't execute template"}
 		res.JSON(http.StatusInternalServerError, w)
 		return
 	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if _, err := fmt.Fprint(w, buffer); err != nil {
+		s.log.WithError(err).Error("couldn't print to response writer for template")
+	}
 }
@@ -0,0 +1,302 @@
+package web
+
+import (
+	"errors"
+	"filekeep/audit"
+	"filekeep/config"
+	"filekeep/fs"
+	"filekeep/webhook"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// tokenAuth returns the name of the API token sent with the request, if it's valid.
+func (s *server) tokenAuth(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	return config.MatchToken(s.opts.Tokens, strings.TrimPrefix(auth, "Bearer "))
+}
+
+// readOnly answers with 403 Forbidden if one of the paths on disk is in a read-only mount, and returns
+// whether it did.
+func (s *server) readOnly(w http.ResponseWriter, paths ...string) bool {
+	for _, path := range paths {
+		if s.fs.ReadOnly(path) {
+			res := httpResponse{Error: true, Message: "read-only mount"}
+			res.JSON(http.StatusForbidden, w)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) uploadHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setRoute(w, "upload")
+	name, ok := s.tokenAuth(r)
+	if !ok {
+		res := httpResponse{Error: true, Message: "a valid API token is required"}
+		res.JSON(http.StatusForbidden, w)
+		return
+	}
+
+	path := s.fs.Join(ps.ByName("path"))
+	if path == s.fs.Root {
+		res := httpResponse{Error: true, Message: "missing file name"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+
+	if s.fs.IsHidden(path) {
+		s.notFoundHandler(w, r)
+		return
+	}
+	if s.readOnly(w, path) {
+		return
+	}
+
+	dir, err := s.fs.Read(filepath.Dir(path))
+	if err != nil || !dir.IsDir {
+		res := httpResponse{Error: true, Message: "parent directory not found"}
+		res.JSON(http.StatusNotFound, w)
+		return
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		res := httpResponse{Error: true, Message: "path is a directory"}
+		res.JSON(http.StatusConflict, w)
+		return
+	}
+
+	body := r.Body
+	if max := s.opts.UploadMaxSize; max > 0 {
+		if r.ContentLength > max {
+			res := httpResponse{Error: true, Message: "file too big"}
+			res.JSON(http.StatusRequestEntityTooLarge, w)
+			return
+		}
+		body = http.MaxBytesReader(w, r.Body, max)
+	}
+
+	if err := writeFile(path, body); err != nil {
+		s.audit(r, audit.Entry{Type: audit.Upload, Success: false, Detail: err.Error()})
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			res := httpResponse{Error: true, Message: "file too big"}
+			res.JSON(http.StatusRequestEntityTooLarge, w)
+			return
+		}
+		s.log.WithError(err).Errorf("couldn't write uploaded file %q", path)
+		res := httpResponse{Error: true, Message: "couldn't write file"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+
+	fd, err := s.fs.Read(path)
+	if err != nil {
+		res := httpResponse{Error: true, Message: "couldn't read uploaded file"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+
+	s.audit(r, audit.Entry{Type: audit.Upload, Success: true})
+	s.fire(r, webhook.Upload, pathpkg.Clean("/"+ps.ByName("path")), fd, "")
+	s.log.WithField("token", name).Debugf("uploaded file %q", path)
+	res := httpResponse{Raw: fd}
+	res.JSON(http.StatusCreated, w)
+}
+
+func (s *server) deleteHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setRoute(w, "delete")
+	name, ok := s.tokenAuth(r)
+	if !ok {
+		res := httpResponse{Error: true, Message: "a valid API token is required"}
+		res.JSON(http.StatusForbidden, w)
+		return
+	}
+
+	path := s.fs.Join(ps.ByName("path"))
+	if s.fs.IsRoot(path) {
+		res := httpResponse{Error: true, Message: "can't delete the root directory or a mount"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+	if s.readOnly(w, path) {
+		return
+	}
+
+	fd, err := s.fs.Read(path)
+	if err != nil || fd.InArchive() {
+		s.notFoundHandler(w, r)
+		return
+	}
+
+	remove := os.Remove
+	if _, recursive := r.URL.Query()["recursive"]; recursive && fd.IsDir {
+		// the token holder only sees the listing, don't take down what it doesn't show
+		if concealed, err := s.fs.Concealed(path); concealed || err != nil || fd.Password != "" {
+			res := httpResponse{Error: true, Message: "directory holds hidden or protected files, can't delete it recursively"}
+			res.JSON(http.StatusConflict, w)
+			return
+		}
+		remove = os.RemoveAll
+	} else if fd.IsDir {
+		// hidden children don't show up in the node, let the OS decide if it's empty
+		if ls, err := ioutil.ReadDir(path); err == nil && len(ls) > 0 {
+			res := httpResponse{Error: true, Message: "directory isn't empty, use ?recursive"}
+			res.JSON(http.StatusConflict, w)
+			return
+		}
+	}
+
+	if err := remove(path); err != nil {
+		s.audit(r, audit.Entry{Type: audit.Delete, Success: false, Detail: err.Error()})
+		s.log.WithError(err).Errorf("couldn't delete %q", path)
+		res := httpResponse{Error: true, Message: "couldn't delete"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+	// a file uploaded later under the same name mustn't inherit the password
+	if err := os.Remove(fs.PasswordFile(path)); err != nil && !os.IsNotExist(err) {
+		s.log.WithError(err).Errorf("couldn't delete the password of %q", path)
+	}
+
+	s.audit(r, audit.Entry{Type: audit.Delete, Success: true})
+	s.fire(r, webhook.Delete, pathpkg.Clean("/"+ps.ByName("path")), fd, "")
+	s.log.WithField("token", name).Debugf("deleted %q", path)
+	res := httpResponse{Raw: fd}
+	res.JSON(http.StatusOK, w)
+}
+
+// writeFile writes r to a temporary file next to path, then renames it over path,
+// so readers never see a partially written file.
+func writeFile(path string, r io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// moveHandler moves or renames the file or directory to the path of the Destination header, which mustn't
+// exist, like the MOVE method of WebDAV.
+func (s *server) moveHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setRoute(w, "move")
+	name, ok := s.tokenAuth(r)
+	if !ok {
+		res := httpResponse{Error: true, Message: "a valid API token is required"}
+		res.JSON(http.StatusForbidden, w)
+		return
+	}
+
+	path := s.fs.Join(ps.ByName("path"))
+	if s.fs.IsRoot(path) {
+		res := httpResponse{Error: true, Message: "can't move the root directory or a mount"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+
+	fd, err := s.fs.Read(path)
+	if err != nil || fd.InArchive() {
+		s.notFoundHandler(w, r)
+		return
+	}
+
+	destination, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || destination.Path == "" {
+		res := httpResponse{Error: true, Message: "missing or invalid Destination header"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+	destPath, ok := trimPrefix(pathpkg.Clean("/"+destination.Path), s.linksOf(r).Prefix)
+	dest := s.fs.Join(destPath)
+	if !ok || s.fs.IsRoot(dest) || s.fs.IsHidden(dest) || strings.HasPrefix(dest, path+string(filepath.Separator)) {
+		res := httpResponse{Error: true, Message: "invalid destination"}
+		res.JSON(http.StatusBadRequest, w)
+		return
+	}
+	if s.readOnly(w, path, dest) {
+		return
+	}
+
+	dir, err := s.fs.Read(filepath.Dir(dest))
+	if err != nil || !dir.IsDir || dir.InArchive() {
+		res := httpResponse{Error: true, Message: "parent directory not found"}
+		res.JSON(http.StatusNotFound, w)
+		return
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		res := httpResponse{Error: true, Message: "destination already exists"}
+		res.JSON(http.StatusConflict, w)
+		return
+	}
+
+	from := pathpkg.Clean("/" + ps.ByName("path"))
+	protected, err := movePassword(path, dest)
+	if err != nil {
+		s.audit(r, audit.Entry{Type: audit.Move, Success: false, Detail: err.Error()})
+		s.log.WithError(err).Errorf("couldn't move the password of %q to %q", path, dest)
+		res := httpResponse{Error: true, Message: "couldn't move"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+	if err := os.Rename(path, dest); err != nil {
+		if protected {
+			movePassword(dest, path)
+		}
+		s.audit(r, audit.Entry{Type: audit.Move, Success: false, Detail: err.Error()})
+		s.log.WithError(err).Errorf("couldn't move %q to %q", path, dest)
+		res := httpResponse{Error: true, Message: "couldn't move"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+
+	moved, err := s.fs.Read(dest)
+	if err != nil {
+		res := httpResponse{Error: true, Message: "couldn't read moved file"}
+		res.JSON(http.StatusInternalServerError, w)
+		return
+	}
+
+	s.audit(r, audit.Entry{Type: audit.Move, Success: true, Detail: "to " + destPath})
+	s.fire(r, webhook.Move, destPath, moved, from)
+	s.log.WithField("token", name).Debugf("moved %q to %q", path, dest)
+	res := httpResponse{Raw: moved}
+	res.JSON(http.StatusOK, w)
+}
+
+// movePassword moves the password file of the file or directory at path to go with dest, and returns
+// whether it had one.
+func movePassword(path, dest string) (bool, error) {
+	err := os.Rename(fs.PasswordFile(path), fs.PasswordFile(dest))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"filekeep/config"
+	"filekeep/fs"
+	"filekeep/webhook"
+	"net/http"
+)
+
+// Webhooks returns the hooks configured in the config c.
+func Webhooks(c *config.Config) []webhook.Hook {
+	hooks := make([]webhook.Hook, len(c.Webhooks.Hooks))
+	for i, h := range c.Webhooks.Hooks {
+		hooks[i] = webhook.Hook{URL: h.URL, Secret: h.Secret, Paths: h.Paths, Events: h.Events}
+		for _, site := range h.Sites {
+			hooks[i].Sites = append(hooks[i].Sites, hostName(site))
+		}
+	}
+	return hooks
+}
+
+// fire notifies the webhooks of the event typ on the URL path, caused by the request r.
+func (s *server) fire(r *http.Request, typ, path string, n *fs.Node, from string) {
+	if s.opts.Webhooks == nil {
+		return
+	}
+	user, _ := s.tokenAuth(r)
+	s.opts.Webhooks.Fire(webhook.Event{Type: typ, Site: s.host, Path: path, From: from, User: user, Node: n})
+}
+
+// webhooksHandler shows the number of pending webhook deliveries and the latest attempts, as JSON.
+func (s *server) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	setRoute(w, "webhooks")
+	if s.opts.Webhooks == nil {
+		s.notFoundHandler(w, r)
+		return
+	}
+	res := httpResponse{Raw: struct {
+		Pending    int                `json:"pending"`
+		Deliveries []webhook.Delivery `json:"deliveries"`
+	}{s.opts.Webhooks.Pending(), s.opts.Webhooks.Deliveries()}}
+	res.JSON(http.StatusOK, w)
+}
@@ -0,0 +1,153 @@
+package web
+
+import (
+	"encoding/json"
+	"filekeep/audit"
+	"filekeep/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Filekeep-Signature") != webhook.Sign("s3cret", b) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(b, &payload)
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	hooks, err := webhook.New([]webhook.Hook{{URL: receiver.URL, Secret: "s3cret", Paths: []string{"/builds/**"}}}, webhook.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hooks.Close()
+
+	root := tempRoot(t, "builds/.keep", "docs/.keep")
+	h := NewHandler(Options{Root: root, Tokens: map[string]string{"ci": "t0ken"}, Webhooks: hooks})
+	do := func(method, target, destination string) int {
+		r := httptest.NewRequest(method, target, strings.NewReader("artifact"))
+		r.Header.Set("Authorization", "Bearer t0ken")
+		r.Header.Set("Destination", destination)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	next := func() map[string]interface{} {
+		select {
+		case p := <-received:
+			return p
+		case <-time.After(2 * time.Second):
+			t.Fatal("no webhook received")
+			return nil
+		}
+	}
+
+	if code := do("PUT", "/docs/notes.txt", ""); code != http.StatusCreated {
+		t.Fatalf("expected the upload to succeed, got %d", code)
+	}
+	if code := do("PUT", "/builds/app.zip", ""); code != http.StatusCreated {
+		t.Fatalf("expected the upload to succeed, got %d", code)
+	}
+	if p := next(); p["event"] != "upload" || p["path"] != "/builds/app.zip" || p["user"] != "ci" || p["node"].(map[string]interface{})["name"] != "app.zip" {
+		t.Errorf("unexpected upload payload %v", p)
+	}
+
+	if code := do("MOVE", "/builds/app.zip", "/builds/app-1.0.zip"); code != http.StatusOK {
+		t.Fatalf("expected the move to succeed, got %d", code)
+	}
+	if p := next(); p["event"] != "move" || p["path"] != "/builds/app-1.0.zip" || p["from"] != "/builds/app.zip" {
+		t.Errorf("unexpected move payload %v", p)
+	}
+
+	if code := do("DELETE", "/builds/app-1.0.zip", ""); code != http.StatusOK {
+		t.Fatalf("expected the deletion to succeed, got %d", code)
+	}
+	if p := next(); p["event"] != "delete" || p["path"] != "/builds/app-1.0.zip" {
+		t.Errorf("unexpected delete payload %v", p)
+	}
+
+	select {
+	case p := <-received:
+		t.Errorf("expected only the events under /builds, got %v", p)
+	default:
+	}
+}
+
+func TestWebhookSites(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	hooks, err := webhook.New([]webhook.Hook{{URL: receiver.URL, Sites: []string{"docs.example"}}}, webhook.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hooks.Close()
+
+	auditLog := filepath.Join(tempRoot(t), "audit.log")
+	log, err := audit.Open(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := map[string]string{"ci": "t0ken"}
+	h := NewHandler(Options{
+		Root: tempRoot(t), Tokens: tokens, Webhooks: hooks, Audit: log,
+		Sites: map[string]Site{"Docs.Example": {Root: tempRoot(t), Tokens: tokens}},
+	})
+	for _, host := range []string{"example.com", "docs.example"} {
+		r := httptest.NewRequest("PUT", "/a.txt", strings.NewReader("a"))
+		r.Host = host
+		r.Header.Set("Authorization", "Bearer t0ken")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected the upload to %s to succeed, got %d", host, w.Code)
+		}
+	}
+
+	select {
+	case p := <-received:
+		if p["site"] != "docs.example" || p["path"] != "/a.txt" {
+			t.Errorf("unexpected payload %v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook received")
+	}
+	select {
+	case p := <-received:
+		t.Errorf("expected only the events of docs.example, got %v", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	var sites []string
+	log.Close()
+	f, err := os.Open(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	audit.Read(f, func(e *audit.Entry) error {
+		sites = append(sites, e.Site)
+		return nil
+	})
+	if len(sites) != 2 || sites[0] != "" || sites[1] != "docs.example" {
+		t.Errorf("expected the audit entries to record their site, got %q", sites)
+	}
+}
@@ -0,0 +1,444 @@
+// Package webhook notifies HTTP endpoints of file events, like uploads, with JSON payloads signed with
+// HMAC-SHA256. Failed deliveries are retried with an exponential backoff, from a queue persisted to disk.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"filekeep/fs"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The types of events.
+const (
+	Upload = "upload"
+	Delete = "delete"
+	Move   = "move"
+)
+
+// recentDeliveries is the number of delivery attempts kept in memory for Deliveries.
+const recentDeliveries = 100
+
+// Hook is an endpoint notified of the events matching its filters.
+type Hook struct {
+	// URL receives the events with POST requests.
+	URL string
+	// Secret signs the payloads, in the X-Filekeep-Signature header. Empty disables the signature.
+	Secret string
+	// Paths are the glob patterns of the paths notified, like "/builds/*.zip". A pattern ending with "/**"
+	// matches everything under a directory. Empty matches all paths.
+	Paths []string
+	// Events are the types of events notified. Empty notifies all of them.
+	Events []string
+	// Sites are the host names of the sites notified, "" for the main one. Empty notifies all of them.
+	Sites []string
+}
+
+// Matches returns whether the hook is notified of the event typ on the path.
+func (h Hook) Matches(typ, path string) bool {
+	if len(h.Events) > 0 && !contains(h.Events, typ) {
+		return false
+	}
+	if len(h.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range h.Paths {
+		if dir := strings.TrimSuffix(pattern, "/**"); dir != pattern {
+			if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := pathpkg.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesSite returns whether the hook is notified of the events of the site, by host name.
+func (h Hook) MatchesSite(site string) bool {
+	return len(h.Sites) == 0 || contains(h.Sites, site)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a change of a file or directory.
+type Event struct {
+	// Type is one of Upload, Delete or Move.
+	Type string `json:"event"`
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+	// Site is the host name of the site of the file or directory, empty for the main one.
+	Site string `json:"site,omitempty"`
+	// Path is the URL path of the file or directory.
+	Path string `json:"path"`
+	// From is the previous path of a moved file or directory.
+	From string `json:"from,omitempty"`
+	// User is the name of the API token causing the event.
+	User string `json:"user,omitempty"`
+	// Node is the file or directory, as it was before being deleted.
+	Node *fs.Node `json:"node"`
+}
+
+// delivery is a payload to deliver to a hook, persisted in the queue until delivered or given up on.
+type delivery struct {
+	ID       string          `json:"id"`
+	URL      string          `json:"url"`
+	Event    string          `json:"event"`
+	Site     string          `json:"site,omitempty"`
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body"`
+	Attempts int             `json:"attempts"`
+	Next     time.Time       `json:"next"`
+}
+
+// Delivery is an entry of the delivery log: an attempt to deliver an event to a hook.
+type Delivery struct {
+	Time    time.Time `json:"time"`
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Event   string    `json:"event"`
+	Site    string    `json:"site,omitempty"`
+	Path    string    `json:"path"`
+	Attempt int       `json:"attempt"`
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Success bool      `json:"success"`
+	// GaveUp tells the delivery won't be attempted again.
+	GaveUp bool `json:"gave_up,omitempty"`
+}
+
+// Options configures a Dispatcher.
+type Options struct {
+	// Queue is the file persisting the pending deliveries across restarts. Empty keeps them in memory only.
+	Queue string
+	// Log receives the delivery log as JSON lines, if set.
+	Log io.Writer
+	// Timeout is the timeout of a delivery attempt.
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts before giving up on a delivery.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled by every further failure up to MaxBackoff.
+	Backoff, MaxBackoff time.Duration
+	// Logger receives errors. Defaults to the logrus standard logger.
+	Logger logrus.FieldLogger
+}
+
+// Dispatcher delivers the events to the hooks in the background, safe for concurrent use.
+type Dispatcher struct {
+	opts   Options
+	client *http.Client
+
+	mu      sync.Mutex
+	hooks   []Hook
+	pending []*delivery
+	recent  []Delivery
+
+	wake chan struct{}
+	done chan struct{}
+	once sync.Once
+	now  func() time.Time
+}
+
+// New returns a Dispatcher notifying hooks, with the deliveries left in the queue of opts being retried.
+func New(hooks []Hook, opts Options) (*Dispatcher, error) {
+	if opts.Logger == nil {
+		opts.Logger = logrus.StandardLogger()
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+
+	d := &Dispatcher{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		hooks:  hooks,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		now:    time.Now,
+	}
+	if opts.Queue != "" {
+		b, err := ioutil.ReadFile(opts.Queue)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("couldn't read webhook queue: %s", err)
+		}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &d.pending); err != nil {
+				return nil, fmt.Errorf("couldn't decode webhook queue: %s", err)
+			}
+		}
+	}
+
+	go d.run()
+	return d, nil
+}
+
+// SetHooks replaces the hooks notified of the next events. Pending deliveries to removed hooks are dropped.
+func (d *Dispatcher) SetHooks(hooks []Hook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks = hooks
+}
+
+// Fire queues the delivery of the event e to the hooks matching it.
+func (d *Dispatcher) Fire(e Event) {
+	if d == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = d.now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	queued := false
+	for _, h := range d.hooks {
+		if !h.MatchesSite(e.Site) || (!h.Matches(e.Type, e.Path) && (e.From == "" || !h.Matches(e.Type, e.From))) {
+			continue
+		}
+
+		id := make([]byte, 8)
+		rand.Read(id)
+		body, err := json.Marshal(struct {
+			ID string `json:"id"`
+			Event
+		}{hex.EncodeToString(id), e})
+		if err != nil {
+			d.opts.Logger.WithError(err).Error("couldn't encode webhook payload")
+			return
+		}
+
+		d.pending = append(d.pending, &delivery{
+			ID:    hex.EncodeToString(id),
+			URL:   h.URL,
+			Event: e.Type,
+			Site:  e.Site,
+			Path:  e.Path,
+			Body:  body,
+			Next:  e.Time,
+		})
+		queued = true
+	}
+	if !queued {
+		return
+	}
+
+	d.save()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Deliveries returns the latest delivery attempts, the newest first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]Delivery, len(d.recent))
+	for i, entry := range d.recent {
+		list[len(list)-1-i] = entry
+	}
+	return list
+}
+
+// Pending returns the number of deliveries waiting to be attempted.
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+// Close stops the deliveries. The pending ones stay in the queue.
+func (d *Dispatcher) Close() error {
+	d.once.Do(func() { close(d.done) })
+	return nil
+}
+
+func (d *Dispatcher) run() {
+	for {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+
+		next, ok := d.due()
+		if ok {
+			d.deliver(next)
+			continue
+		}
+
+		wait := time.Hour
+		if next != nil {
+			wait = next.Next.Sub(d.now())
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-d.done:
+			t.Stop()
+			return
+		case <-d.wake:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// due returns the delivery due the soonest, and whether it's due already.
+func (d *Dispatcher) due() (*delivery, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var next *delivery
+	for _, p := range d.pending {
+		if next == nil || p.Next.Before(next.Next) {
+			next = p
+		}
+	}
+	return next, next != nil && !next.Next.After(d.now())
+}
+
+// hook returns the hook with the url, or false if it was removed.
+func (d *Dispatcher) hook(url string) (Hook, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, h := range d.hooks {
+		if h.URL == url {
+			return h, true
+		}
+	}
+	return Hook{}, false
+}
+
+// Sign returns the signature of the payload body with the secret, as sent in the X-Filekeep-Signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver attempts the delivery p, then removes it from the queue or schedules its next attempt.
+func (d *Dispatcher) deliver(p *delivery) {
+	h, ok := d.hook(p.URL)
+	entry := Delivery{Time: d.now(), ID: p.ID, URL: p.URL, Event: p.Event, Site: p.Site, Path: p.Path, Attempt: p.Attempts + 1}
+	if ok {
+		entry.Status, entry.Error = d.post(h, p)
+		entry.Success = entry.Error == ""
+	} else {
+		entry.Error = "hook removed from the config"
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p.Attempts++
+	if entry.Success || !ok || p.Attempts >= d.opts.MaxAttempts {
+		entry.GaveUp = !entry.Success
+		for i, v := range d.pending {
+			if v == p {
+				d.pending = append(d.pending[:i], d.pending[i+1:]...)
+				break
+			}
+		}
+	} else {
+		p.Next = d.now().Add(d.backoff(p.Attempts))
+	}
+	d.save()
+	d.log(entry)
+}
+
+// post sends the payload of p to the hook h, returning the response status and an error message.
+func (d *Dispatcher) post(h Hook, p *delivery) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(p.Body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "filekeep-webhook")
+	req.Header.Set("X-Filekeep-Event", p.Event)
+	req.Header.Set("X-Filekeep-Delivery", p.ID)
+	if h.Secret != "" {
+		req.Header.Set("X-Filekeep-Signature", Sign(h.Secret, p.Body))
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Sprintf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, ""
+}
+
+// backoff returns the delay before the attempt following the failed attempt number n.
+func (d *Dispatcher) backoff(n int) time.Duration {
+	b := d.opts.Backoff
+	for i := 1; i < n && (d.opts.MaxBackoff <= 0 || b < d.opts.MaxBackoff); i++ {
+		b *= 2
+	}
+	if d.opts.MaxBackoff > 0 && b > d.opts.MaxBackoff {
+		b = d.opts.MaxBackoff
+	}
+	return b
+}
+
+// log records the delivery attempt entry. The caller holds mu.
+func (d *Dispatcher) log(entry Delivery) {
+	d.recent = append(d.recent, entry)
+	if len(d.recent) > recentDeliveries {
+		d.recent = d.recent[len(d.recent)-recentDeliveries:]
+	}
+
+	fields := logrus.Fields{"url": entry.URL, "event": entry.Event, "path": entry.Path, "attempt": entry.Attempt}
+	if !entry.Success {
+		d.opts.Logger.WithFields(fields).Warnf("couldn't deliver webhook: %s", entry.Error)
+	}
+	if d.opts.Log == nil {
+		return
+	}
+	b, _ := json.Marshal(entry)
+	if _, err := d.opts.Log.Write(append(b, '\n')); err != nil {
+		d.opts.Logger.WithError(err).Error("couldn't write webhook delivery log")
+	}
+}
+
+// save writes the pending deliveries to the queue file, replacing it at once. The caller holds mu.
+func (d *Dispatcher) save() {
+	if d.opts.Queue == "" {
+		return
+	}
+	b, err := json.Marshal(d.pending)
+	if err == nil {
+		tmp := d.opts.Queue + ".tmp"
+		if err = ioutil.WriteFile(tmp, b, 0600); err == nil {
+			err = os.Rename(tmp, filepath.Clean(d.opts.Queue))
+		}
+	}
+	if err != nil {
+		d.opts.Logger.WithError(err).Error("couldn't save webhook queue")
+	}
+}
@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"filekeep/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	h := Hook{Paths: []string{"/builds/**", "/*.zip"}, Events: []string{Upload, Move}}
+	cases := []struct {
+		typ, path string
+		want      bool
+	}{
+		{Upload, "/builds/a/b.tar.gz", true},
+		{Upload, "/builds", true},
+		{Upload, "/buildsx/a", false},
+		{Upload, "/release.zip", true},
+		{Upload, "/docs/release.zip", false},
+		{Delete, "/builds/a", false},
+	}
+	for _, c := range cases {
+		if got := h.Matches(c.typ, c.path); got != c.want {
+			t.Errorf("Matches(%q, %q) = %v, expected %v", c.typ, c.path, got, c.want)
+		}
+	}
+	h.Sites = []string{"", "docs.example"}
+	if !h.MatchesSite("") || !h.MatchesSite("docs.example") || h.MatchesSite("builds.example") {
+		t.Error("expected the hook to match the main site and docs.example only")
+	}
+}
+
+// receiver records the requests it gets, failing the first failures ones.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	bodies   [][]byte
+	headers  []http.Header
+	got      chan struct{}
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	rc.bodies = append(rc.bodies, b)
+	rc.headers = append(rc.headers, r.Header)
+	rc.got <- struct{}{}
+}
+
+func wait(t *testing.T, rc *receiver) {
+	select {
+	case <-rc.got:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no delivery")
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filekeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rc := &receiver{failures: 2, got: make(chan struct{}, 10)}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	log := new(bytes.Buffer)
+	opts := Options{Queue: filepath.Join(dir, "queue.json"), Timeout: time.Second, MaxAttempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	hooks := []Hook{{URL: server.URL, Secret: "s3cret", Paths: []string{"/builds/**"}}}
+	d, err := New(hooks, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Fire(Event{Type: Upload, Path: "/docs/a.txt"})
+	d.Fire(Event{Type: Move, Path: "/builds/b.zip", From: "/tmp/b.zip", User: "ci", Node: &fs.Node{Name: "b.zip", Size: 42}})
+	wait(t, rc)
+
+	var payload struct {
+		ID    string   `json:"id"`
+		Event string   `json:"event"`
+		Path  string   `json:"path"`
+		From  string   `json:"from"`
+		Node  *fs.Node `json:"node"`
+	}
+	if err := json.Unmarshal(rc.bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != Move || payload.From != "/tmp/b.zip" || payload.Node.Name != "b.zip" || payload.Node.Size != 42 {
+		t.Errorf("unexpected payload %s", rc.bodies[0])
+	}
+	h := rc.headers[0]
+	if h.Get("X-Filekeep-Signature") != Sign("s3cret", rc.bodies[0]) || h.Get("X-Filekeep-Delivery") != payload.ID || h.Get("X-Filekeep-Event") != Move {
+		t.Errorf("unexpected headers %v", h)
+	}
+
+	deliveries := d.Deliveries()
+	for i := 0; i < 100 && len(deliveries) < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		deliveries = d.Deliveries()
+	}
+	if len(deliveries) != 3 || !deliveries[0].Success || deliveries[0].Attempt != 3 || deliveries[2].Status != http.StatusBadGateway {
+		t.Errorf("expected 2 failed attempts and a successful one, got %+v", deliveries)
+	}
+	d.Close()
+
+	// the queue survives restarts
+	server.Close()
+	d, err = New(hooks, Options{Queue: opts.Queue, Log: log, Timeout: time.Second, MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	d.Fire(Event{Type: Upload, Path: "/builds/c.zip"})
+	d, err = New(hooks, Options{Queue: opts.Queue, Log: log, Timeout: time.Second, MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for i := 0; i < 100 && d.Pending() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var entry Delivery
+	if err := json.Unmarshal(log.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a delivery log entry, got %q: %s", log, err)
+	}
+	if entry.Path != "/builds/c.zip" || entry.Success || !entry.GaveUp {
+		t.Errorf("expected the queued delivery to be attempted and given up on, got %+v", entry)
+	}
+}